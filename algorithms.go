@@ -0,0 +1,54 @@
+package nssh
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// SSH algorithms which golang.org/x/crypto/ssh supports as a client, including
+// weak ones for legacy devices. Empty ConnectOptions.Ciphers, MACs and
+// KeyExchanges use the modern subset preferred by golang.org/x/crypto/ssh.
+var (
+	SupportedCiphers = []string{
+		"aes128-gcm@openssh.com", "aes256-gcm@openssh.com",
+		"chacha20-poly1305@openssh.com",
+		"aes128-ctr", "aes192-ctr", "aes256-ctr",
+		"aes128-cbc", "3des-cbc",
+		"arcfour256", "arcfour128", "arcfour",
+	}
+	SupportedMACs = []string{
+		"hmac-sha2-256-etm@openssh.com", "hmac-sha2-512-etm@openssh.com",
+		"hmac-sha2-256", "hmac-sha2-512",
+		"hmac-sha1", "hmac-sha1-96",
+	}
+	SupportedKeyExchanges = []string{
+		"curve25519-sha256", "curve25519-sha256@libssh.org",
+		"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+		"diffie-hellman-group14-sha256", "diffie-hellman-group16-sha512",
+		"diffie-hellman-group-exchange-sha256",
+		"diffie-hellman-group14-sha1", "diffie-hellman-group1-sha1",
+		"diffie-hellman-group-exchange-sha1",
+	}
+)
+
+// ValidateAlgorithms returns an error if any of ciphers, macs or kex is not
+// supported
+func ValidateAlgorithms(ciphers, macs, kex []string) error {
+	for _, a := range []struct {
+		kind      string
+		names     []string
+		supported []string
+	}{
+		{"cipher", ciphers, SupportedCiphers},
+		{"MAC", macs, SupportedMACs},
+		{"key exchange", kex, SupportedKeyExchanges},
+	} {
+		for _, name := range a.names {
+			if !slices.Contains(a.supported, name) {
+				return fmt.Errorf("unsupported %s %s, specify one of %s", a.kind, name, strings.Join(a.supported, ", "))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package nssh
+
+import (
+	"github.com/0x6b/nssh/models"
+	"golang.org/x/crypto/ssh"
+	"io"
+)
+
+// API is the set of operations on SORACOM API and devices which the commands
+// of nssh use. SoracomClient implements it, and others may replace it, e.g.
+// in tests.
+type API interface {
+	Credentials() (apiKey, token string)
+	APIEndpoint() string
+	IPChecker() *CheckIPClient
+	CoverageType() string
+	AutoCoverage() bool
+	ForCoverageType(coverageType string) (API, error)
+
+	FindSIMsByName(name string) ([]models.SIM, error)
+	FindOnlineSIMs() ([]models.SIM, error)
+	FindOnlineSIMsByName(name string) ([]models.SIM, error)
+	GetSIM(simID string) (*models.SIM, error)
+	GetOnlineSIM(simID string) (*models.SIM, error)
+	FindOnlineSIMByIMSI(imsi string) (*models.SIM, error)
+	GetSubscriber(imsi string) (*models.Subscriber, error)
+	FindSubscribersByName(name string) ([]models.Subscriber, error)
+
+	ListPortMappings() ([]models.PortMapping, error)
+	ListPortMappingsFunc(fn func(models.PortMapping) error) error
+	FindPortMappingsForSIM(sim models.SIM) ([]models.PortMapping, error)
+	FindPortMappingsForSubscriber(subscriber models.Subscriber) ([]models.PortMapping, error)
+	FindAvailablePortMappingsForSIM(sim models.SIM, port int, tlsRequired bool) ([]models.PortMapping, error)
+	ResolveSourceCIDRs(sourceCIDRs []string) ([]string, error)
+	CreatePortMappingForSIM(sim models.SIM, port, duration int, sourceCIDRs []string, tlsRequired bool) (*models.PortMapping, error)
+	EnsurePortMapping(sim models.SIM, port, duration int, sourceCIDRs []string, tlsRequired bool) (*models.PortMapping, bool, error)
+	DeletePortMapping(portMapping *models.PortMapping) error
+
+	Connect(login, identity string, portMapping *models.PortMapping, opts ConnectOptions) error
+	Dial(login, identity string, portMapping *models.PortMapping, opts ConnectOptions) (*ssh.Client, error)
+	Shell(client *ssh.Client, portMapping *models.PortMapping, opts ConnectOptions) error
+	Forward(client *ssh.Client, forwards []LocalForward) (io.Closer, error)
+	Run(login, identity string, portMapping *models.PortMapping, command string, stdout, stderr io.Writer, opts ConnectOptions) error
+	RunScript(login, identity string, portMapping *models.PortMapping, script []byte, args []string, stdout, stderr io.Writer, opts ConnectOptions) error
+}
+
+var _ API = (*SoracomClient)(nil)
+
+// APIEndpoint returns the base URL of SORACOM API the client calls
+func (c *SoracomClient) APIEndpoint() string {
+	return c.Endpoint
+}
+
+// IPChecker returns the client to determine current global IP address, which
+// may be modified, e.g. to determine it through a jump host
+func (c *SoracomClient) IPChecker() *CheckIPClient {
+	return c.CheckIP
+}
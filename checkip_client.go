@@ -8,33 +8,81 @@ import (
 	"strings"
 )
 
+const (
+	// DefaultCheckIPEndpoint is the default endpoint to determine current global IP address
+	DefaultCheckIPEndpoint = "https://checkip.amazonaws.com/"
+	// DefaultCheckIPv4Endpoint is the endpoint which is reachable only via IPv4,
+	// used if DefaultCheckIPEndpoint or its override returns IPv6 address
+	DefaultCheckIPv4Endpoint = "https://ipv4.icanhazip.com/"
+)
+
+// A CheckIPClient represents a client for https://checkip.amazonaws.com/ or
+// compatible service, which returns caller's IP address in plain text
+type CheckIPClient struct {
+	Client       *http.Client
+	Endpoint     string // endpoint to determine current global IP address
+	IPv4Endpoint string // endpoint to determine current global IPv4 address
+}
+
 // GetIP gets current global IP address using https://checkip.amazonaws.com/
+// with http.DefaultClient
 func GetIP() (net.IP, error) {
-	client := http.DefaultClient
-	req, err := http.NewRequest("GET", "https://checkip.amazonaws.com/", nil)
+	c := CheckIPClient{
+		Client:       http.DefaultClient,
+		Endpoint:     DefaultCheckIPEndpoint,
+		IPv4Endpoint: DefaultCheckIPv4Endpoint,
+	}
+	return c.GetIP()
+}
+
+// GetIP gets current global IP address. As Napter source CIDRs are usually
+// IPv4, if the endpoint returns IPv6 address, GetIP tries the IPv4 endpoint,
+// and returns IPv4 address if available.
+func (c *CheckIPClient) GetIP() (net.IP, error) {
+	ip, err := c.getIP(c.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if ip.To4() == nil && c.IPv4Endpoint != "" {
+		ipv4, err := c.getIP(c.IPv4Endpoint)
+		if err == nil && ipv4.To4() != nil {
+			return ipv4, nil
+		}
+	}
+	return ip, nil
+}
+
+func (c *CheckIPClient) getIP(endpoint string) (net.IP, error) {
+	req, err := http.NewRequest("GET", endpoint, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	res, err := client.Do(req)
+	res, err := c.Client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 
+	defer func() {
+		err := res.Body.Close()
+		if err != nil {
+			fmt.Println("failed to close response", err)
+		}
+	}()
+
 	if res.StatusCode >= http.StatusBadRequest {
-		defer func() {
-			err := res.Body.Close()
-			if err != nil {
-				fmt.Println("failed to close response", err)
-			}
-		}()
 		return nil, fmt.Errorf("%s: %s %s", res.Status, req.Method, req.URL)
 	}
 
-	ip, err := io.ReadAll(res.Body)
+	b, err := io.ReadAll(io.LimitReader(res.Body, 1024))
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response from https://checkip.amazonaws.com: %w", err)
+		return nil, fmt.Errorf("failed to read response from %s: %w", endpoint, err)
 	}
 
-	return net.ParseIP(strings.TrimSpace(string(ip))), nil
+	ip := net.ParseIP(strings.TrimSpace(string(b)))
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address returned from %s", endpoint)
+	}
+	return ip, nil
 }
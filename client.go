@@ -1,31 +1,172 @@
 package nssh
 
 import (
+	"bytes"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/0x6b/nssh/models"
-	"github.com/mitchellh/go-homedir"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 	"golang.org/x/crypto/ssh/terminal"
 	"io"
+	"log/slog"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
-	"path/filepath"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 )
 
 // A SoracomClient represents an API client for SORACOM API. See
 // https://developers.soracom.io/en/docs/tools/api-reference/ or
-// https://dev.soracom.io/jp/docs/api_guide/
+// https://dev.soracom.io/jp/docs/api_guide/. It is safe for concurrent use
+// by multiple goroutines, once created.
 type SoracomClient struct {
-	APIKey   string // API key
-	Token    string // API token
+	APIKey   string // API key, updated on re-authentication. Use Credentials to read it concurrently
+	Token    string // API token, updated on re-authentication. Use Credentials to read it concurrently
 	Client   *http.Client
 	Endpoint string
+	CheckIP  *CheckIPClient // client to determine current global IP address
+	Logger   *slog.Logger   // logger for debugging, which never logs credentials
+	Emitter  *Emitter       // emitter to report progress
+
+	tokenTimeout    int    // token timeout in seconds
+	checkIPEndpoint string // endpoint to determine current global IP address
+	authKeyID       string // auth key ID, empty if API key and token are given
+	authKey         string // auth key, empty if API key and token are given
+	cacheProfile    string // profile name to cache the token for, empty if the cache is disabled
+	noTokenCache    bool   // do not read nor write the token cache
+	simLimit        int    // maximum number of SIMs returned from query APIs, 0 for unlimited
+	lang            string // language of API error messages, "en" or "ja"
+	apiPrefix       string // path prefix of the API under the endpoint, e.g. "v1"
+	coverageType    string // coverage type of the endpoint, empty if specified with WithEndpoint
+	autoCoverage    bool   // coverage type was AutoCoverageType, so SIMs may be in the other ones
+
+	// newFor creates the client for another coverage type with the same
+	// credentials source and options, nil if not supported
+	newFor func(coverageType string) (*SoracomClient, error)
+
+	coverageMu      sync.Mutex                // guards coverageClients and simClients
+	coverageClients map[string]coverageClient // clients of the other coverage types by coverage type
+	simClients      map[string]*SoracomClient // clients of the other coverage types by ID of the SIM found there
+
+	credMu sync.RWMutex // guards APIKey and Token
+	authMu sync.Mutex   // serializes re-authentication, so that concurrent ones are done once
+}
+
+// An Option configures SoracomClient
+type Option func(*SoracomClient)
+
+// default and range of timeout of the API token in seconds, which SORACOM API
+// accepts
+const (
+	DefaultTokenTimeout = 24 * 60 * 60
+	MinTokenTimeout     = 180
+	MaxTokenTimeout     = 48 * 60 * 60
+)
+
+// ValidateTokenTimeout returns an error if seconds is out of the range of
+// timeout of the API token SORACOM API accepts
+func ValidateTokenTimeout(seconds int) error {
+	if seconds < MinTokenTimeout || seconds > MaxTokenTimeout {
+		return fmt.Errorf("invalid token timeout %d, specify %d-%d seconds", seconds, MinTokenTimeout, MaxTokenTimeout)
+	}
+	return nil
+}
+
+// WithTokenTimeout sets timeout of the API token in seconds, DefaultTokenTimeout
+// if not specified
+func WithTokenTimeout(seconds int) Option {
+	return func(c *SoracomClient) {
+		c.tokenTimeout = seconds
+	}
+}
+
+// WithoutTokenCache disables reading and writing the cached API key and token
+// under the profile directory
+func WithoutTokenCache() Option {
+	return func(c *SoracomClient) {
+		c.noTokenCache = true
+	}
+}
+
+// WithCheckIPEndpoint sets the endpoint to determine current global IP
+// address, instead of https://checkip.amazonaws.com/
+func WithCheckIPEndpoint(endpoint string) Option {
+	return func(c *SoracomClient) {
+		c.checkIPEndpoint = endpoint
+	}
+}
+
+// WithSIMLimit sets maximum number of SIMs returned from the methods which
+// query SIMs, for safety with a large number of SIMs. 0 means unlimited.
+func WithSIMLimit(limit int) Option {
+	return func(c *SoracomClient) {
+		c.simLimit = limit
+	}
+}
+
+// WithLogger sets logger for debugging. See NewLogger.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *SoracomClient) {
+		c.Logger = logger
+	}
+}
+
+// WithLang sets language of error messages from SORACOM API, "en" or "ja"
+func WithLang(lang string) Option {
+	return func(c *SoracomClient) {
+		c.lang = lang
+	}
+}
+
+// WithEmitter sets emitter to report progress. Human readable messages are
+// written to stdout by default.
+func WithEmitter(emitter *Emitter) Option {
+	return func(c *SoracomClient) {
+		c.Emitter = emitter
+	}
+}
+
+// WithEndpoint sets base URL of SORACOM API, e.g. for a staging environment,
+// instead of the one for the coverage type
+func WithEndpoint(endpoint string) Option {
+	return func(c *SoracomClient) {
+		c.Endpoint = strings.TrimSuffix(endpoint, "/")
+	}
+}
+
+// WithAPIPrefix sets path prefix of the API under the endpoint instead of
+// "v1", e.g. for a gateway or a mock server mounted elsewhere. Empty prefix
+// means the API is at the root of the endpoint.
+func WithAPIPrefix(prefix string) Option {
+	return func(c *SoracomClient) {
+		c.apiPrefix = strings.Trim(prefix, "/")
+	}
+}
+
+// WithHTTPClient sets http.Client which is used for both SORACOM API and
+// https://checkip.amazonaws.com/
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *SoracomClient) {
+		c.Client = client
+	}
+}
+
+// WithTransport sets http.RoundTripper of the http.Client, e.g. to replace
+// SORACOM API with a stub in tests. Apply after WithHTTPClient if both are used.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *SoracomClient) {
+		client := *c.Client
+		client.Transport = transport
+		c.Client = &client
+	}
 }
 
 type apiParams struct {
@@ -34,40 +175,187 @@ type apiParams struct {
 	body   string
 }
 
-// NewSoracomClient returns new SoracomClient for caller
-func NewSoracomClient(coverageType, profileName string) (*SoracomClient, error) {
-	akid, ak, ct, err := getAuthInfoFromProfile(profileName)
-	if err != nil {
-		return nil, err
+// NewSoracomClient returns new SoracomClient for caller. Credentials are
+// taken from the following sources, in order of precedence:
+//
+//  1. SORACOM_API_KEY and SORACOM_TOKEN environment variables, used as is
+//  2. SORACOM_AUTH_KEY_ID and SORACOM_AUTH_KEY environment variables
+//  3. the profile specified by profileName
+//
+// When the profile is used, API key and token are cached under the profile
+// directory, and reused until they expire unless WithoutTokenCache is given.
+//
+// If coverageType is empty, coverage type of the profile is used. If no
+// profile is read, SORACOM_COVERAGE_TYPE environment variable or
+// AutoCoverageType is used. With AutoCoverageType, the client calls API of the
+// first of CoverageTypes, and ForCoverageType creates the client for another.
+func NewSoracomClient(coverageType, profileName string, options ...Option) (*SoracomClient, error) {
+	apiKey, token := os.Getenv("SORACOM_API_KEY"), os.Getenv("SORACOM_TOKEN")
+
+	var akid, ak, ct string
+	var fromProfile bool
+	if apiKey == "" || token == "" {
+		var err error
+		akid, ak, ct, fromProfile, err = getAuthInfo(profileName)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	if coverageType == "" {
 		coverageType = ct
 	}
+	if coverageType == "" {
+		coverageType = os.Getenv("SORACOM_COVERAGE_TYPE")
+	}
+	if coverageType == "" {
+		coverageType = AutoCoverageType
+	}
 
-	endpoint, err := getEndpoint(coverageType)
-	if err != nil {
+	c := newClient(apiKey, token)
+	c.authKeyID = akid
+	c.authKey = ak
+	if err := c.apply(coverageType, options); err != nil {
 		return nil, err
 	}
+	c.newFor = func(coverageType string) (*SoracomClient, error) {
+		return NewSoracomClient(coverageType, profileName, options...)
+	}
 
-	c := SoracomClient{
-		Client:   http.DefaultClient,
-		Endpoint: endpoint,
-		APIKey:   "",
-		Token:    "",
+	if c.APIKey != "" && c.Token != "" {
+		return c, nil
 	}
 
+	if fromProfile && !c.noTokenCache {
+		c.cacheProfile = profileName
+		if tc, ok := loadTokenCache(profileName, c.Endpoint, c.authKeyID, c.tokenTimeout); ok {
+			c.APIKey = tc.APIKey
+			c.Token = tc.Token
+			return c, nil
+		}
+	}
+
+	if err := c.authenticate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewMockSoracomClient returns SoracomClient which is backed by data instead
+// of SORACOM API, e.g. for demos and development. Neither credentials nor
+// profile are read. options are applied as NewSoracomClient, but the transport
+// is always replaced with NewMockTransport.
+func NewMockSoracomClient(data *MockData, options ...Option) (*SoracomClient, error) {
+	c := newClient("api-mock", "mock")
+	if err := c.apply("jp", append(options, WithTransport(NewMockTransport(data)))); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// newClient returns SoracomClient with the credentials and default settings
+func newClient(apiKey, token string) *SoracomClient {
+	return &SoracomClient{
+		Client:       http.DefaultClient,
+		Logger:       NewLogger(io.Discard, 0),
+		Emitter:      NewTextEmitter(os.Stdout, "en"),
+		lang:         "en",
+		apiPrefix:    "v1",
+		APIKey:       apiKey,
+		Token:        token,
+		tokenTimeout: DefaultTokenTimeout,
+
+		checkIPEndpoint: DefaultCheckIPEndpoint,
+	}
+}
+
+// apply applies options to the client, and sets up the endpoint for
+// coverageType unless specified with WithEndpoint, and CheckIP
+func (c *SoracomClient) apply(coverageType string, options []Option) error {
+	for _, o := range options {
+		o(c)
+	}
+	if err := ValidateTokenTimeout(c.tokenTimeout); err != nil {
+		return err
+	}
+	if c.Endpoint == "" {
+		ct, err := NormalizeCoverageType(coverageType)
+		if err != nil {
+			return err
+		}
+		if ct == AutoCoverageType {
+			ct, c.autoCoverage = CoverageTypes[0], true
+		}
+		c.coverageType = ct
+		c.Endpoint = getEndpoint(ct)
+	} else if err := validateEndpoint(c.Endpoint); err != nil {
+		return err
+	}
+	c.CheckIP = &CheckIPClient{
+		Client:       c.Client,
+		Endpoint:     c.checkIPEndpoint,
+		IPv4Endpoint: DefaultCheckIPv4Endpoint,
+	}
+	return nil
+}
+
+// CoverageType returns the coverage type whose API the client calls, "jp", "g"
+// or "sandbox", or empty if the endpoint is specified with WithEndpoint
+func (c *SoracomClient) CoverageType() string {
+	return c.coverageType
+}
+
+// AutoCoverage returns true if the client was created with AutoCoverageType,
+// so that SIMs not found may be in the other coverage types
+func (c *SoracomClient) AutoCoverage() bool {
+	return c.autoCoverage
+}
+
+// ForCoverageType returns new client for coverageType, with the same
+// credentials source and options as c, which authenticates with API of the
+// coverage type
+func (c *SoracomClient) ForCoverageType(coverageType string) (API, error) {
+	if c.newFor == nil {
+		return nil, errors.New("the client cannot switch coverage type")
+	}
+	return c.newFor(coverageType)
+}
+
+// Credentials returns current API key and token of the client
+func (c *SoracomClient) Credentials() (apiKey, token string) {
+	c.credMu.RLock()
+	defer c.credMu.RUnlock()
+	return c.APIKey, c.Token
+}
+
+// reauthenticate authenticates again unless the token has been refreshed since
+// staleToken was rejected, so that concurrent callers authenticate only once
+func (c *SoracomClient) reauthenticate(staleToken string) error {
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+
+	if _, token := c.Credentials(); token != staleToken {
+		return nil
+	}
+	return c.authenticate()
+}
+
+// authenticate performs the auth handshake with the auth key, and updates API
+// key and token of the client. The token cache is updated if enabled.
+func (c *SoracomClient) authenticate() error {
+	expiresAt := time.Now().Add(time.Duration(c.tokenTimeout) * time.Second)
+
 	body, err := json.Marshal(struct {
 		AuthKeyID           string `json:"authKeyId"`
 		AuthKey             string `json:"authKey"`
 		TokenTimeoutSeconds int    `json:"tokenTimeoutSeconds"`
 	}{
-		AuthKeyID:           akid,
-		AuthKey:             ak,
-		TokenTimeoutSeconds: 24 * 60 * 60,
+		AuthKeyID:           c.authKeyID,
+		AuthKey:             c.authKey,
+		TokenTimeoutSeconds: c.tokenTimeout,
 	})
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	res, err := c.callAPI(&apiParams{
@@ -76,65 +364,112 @@ func NewSoracomClient(coverageType, profileName string) (*SoracomClient, error)
 		body:   string(body),
 	})
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	ar := struct {
 		APIKey string `json:"apiKey"`
 		Token  string `json:"token"`
 	}{}
-	if err := json.NewDecoder(res.Body).Decode(&ar); err != nil {
-		return nil, fmt.Errorf("failed to decode auth response: %w", err)
+	if err := decodeResponse(res, &ar); err != nil {
+		return fmt.Errorf("failed to decode auth response: %w", err)
 	}
 
+	c.credMu.Lock()
 	c.APIKey = ar.APIKey
 	c.Token = ar.Token
-	return &c, nil
+	c.credMu.Unlock()
+
+	if c.cacheProfile != "" {
+		err := saveTokenCache(c.cacheProfile, &tokenCache{
+			Endpoint:  c.Endpoint,
+			AuthKeyID: c.authKeyID,
+			APIKey:    ar.APIKey,
+			Token:     ar.Token,
+			ExpiresAt: expiresAt,
+		})
+		if err != nil {
+			c.Emitter.Emit("token_cache_failed", map[string]any{"error": err}, "→ failed to cache the token: %v", err)
+		}
+	}
+	return nil
 }
 
-// FindSIMsByName finds SIMs which has the specified name
+// FindSIMsByName finds SIMs which has the specified name. With
+// AutoCoverageType, the other coverage types are searched in order if not
+// found, as the other methods which look up SIMs.
 func (c *SoracomClient) FindSIMsByName(name string) ([]models.SIM, error) {
-	res, err := c.callAPI(&apiParams{
-		method: "GET",
-		path:   fmt.Sprintf("query/sims?name=%s", url.QueryEscape(name)),
-		body:   "",
-	})
+	return searchCoverages(c, func(o *SoracomClient) ([]models.SIM, error) {
+		return o.findSIMsByName(name)
+	}, simKey)
+}
+
+func (c *SoracomClient) findSIMsByName(name string) ([]models.SIM, error) {
+	return queryAll[models.SIM](c, fmt.Sprintf("query/sims?limit=100&name=%s", url.QueryEscape(name)))
+}
+
+// FindOnlineSIMs finds online subscribers. With AutoCoverageType, the ones of
+// all coverage types are returned.
+func (c *SoracomClient) FindOnlineSIMs() ([]models.SIM, error) {
+	sims, err := c.findOnlineSIMs()
 	if err != nil {
 		return nil, err
 	}
+	for _, o := range c.otherClients() {
+		s, err := o.findOnlineSIMs()
+		if err != nil {
+			c.Logger.Debug("failed to find online SIMs on coverage type", "coverageType", o.coverageType, "error", err)
+			continue
+		}
+		for _, sim := range s {
+			c.remember(sim.ID, o)
+		}
+		sims = append(sims, s...)
+	}
+	if c.simLimit > 0 && len(sims) > c.simLimit {
+		sims = sims[:c.simLimit]
+	}
+	return sims, nil
+}
 
-	var sims []models.SIM
-	err = json.NewDecoder(res.Body).Decode(&sims)
-	return sims, err
+func (c *SoracomClient) findOnlineSIMs() ([]models.SIM, error) {
+	return queryAll[models.SIM](c, "query/sims?limit=100&session_status=ONLINE&search_type=AND")
 }
 
-// FindOnlineSIMs finds online subscribers
-func (c *SoracomClient) FindOnlineSIMs() ([]models.SIM, error) {
-	var results []models.SIM
+// queryAll calls the API with path, e.g. the query API, and follows
+// X-Soracom-Next-Key header to collect SIMs or subscribers in all pages, up to
+// the limit set by WithSIMLimit
+func queryAll[T any](c *SoracomClient, path string) ([]T, error) {
+	var results []T
 	var lastEvaluatedKey string
-	var path string
 
 	for {
+		p := path
 		if lastEvaluatedKey != "" {
-			path = fmt.Sprintf("query/sims?limit=100&session_status=ONLINE&search_type=AND&last_evaluated_key=%s", lastEvaluatedKey)
-		} else {
-			path = fmt.Sprintf("query/sims?limit=100&session_status=ONLINE&search_type=AND")
+			p = fmt.Sprintf("%s&last_evaluated_key=%s", path, url.QueryEscape(lastEvaluatedKey))
 		}
 		res, err := c.callAPI(&apiParams{
 			method: "GET",
-			path:   path,
+			path:   p,
 			body:   "",
 		})
 		if err != nil {
 			return nil, err
 		}
 
-		var sims []models.SIM
-		err = json.NewDecoder(res.Body).Decode(&sims)
+		var page []T
+		err = decodeResponse(res, &page)
 		if err != nil {
 			return nil, err
 		}
-		results = append(results, sims...)
+		results = append(results, page...)
+
+		if c.simLimit > 0 && len(results) >= c.simLimit {
+			if len(results) > c.simLimit || res.Header.Get("X-Soracom-Next-Key") != "" {
+				c.Emitter.Emit("sims_truncated", map[string]any{"limit": c.simLimit}, "→ found more than %d SIMs, ignoring the rest", c.simLimit)
+			}
+			return results[:c.simLimit], nil
+		}
 
 		nextKey := res.Header.Get("X-Soracom-Next-Key")
 		if nextKey != "" {
@@ -149,7 +484,25 @@ func (c *SoracomClient) FindOnlineSIMs() ([]models.SIM, error) {
 
 // FindOnlineSIMsByName finds online SIMs which has the specified name
 func (c *SoracomClient) FindOnlineSIMsByName(name string) ([]models.SIM, error) {
-	sims, err := c.FindSIMsByName(name)
+	return searchCoverages(c, func(o *SoracomClient) ([]models.SIM, error) {
+		return o.findOnlineSIMsByName(name)
+	}, simKey)
+}
+
+func (c *SoracomClient) findOnlineSIMsByName(name string) ([]models.SIM, error) {
+	sims, err := queryAll[models.SIM](c, fmt.Sprintf("query/sims?limit=100&name=%s&session_status=ONLINE&search_type=AND", url.QueryEscape(name)))
+	if !errors.Is(err, &APIError{StatusCode: http.StatusBadRequest}) {
+		return sims, err
+	}
+	// fall back to filtering at client side, if the combined query is rejected
+	c.Logger.Debug("failed to query online SIMs by name, filtering at client side instead", "error", err)
+	return c.filterOnlineSIMsByName(name)
+}
+
+// filterOnlineSIMsByName finds SIMs by name, then filters online ones at
+// client side
+func (c *SoracomClient) filterOnlineSIMsByName(name string) ([]models.SIM, error) {
+	sims, err := c.findSIMsByName(name)
 	if err != nil {
 		return nil, err
 	}
@@ -163,8 +516,20 @@ func (c *SoracomClient) FindOnlineSIMsByName(name string) ([]models.SIM, error)
 	return onlineSIMs, nil
 }
 
+// Errors returned by the methods which look up a SIM, wrapped with the SIM
+var (
+	ErrSIMNotFound = errors.New("SIM not found")
+	ErrSIMOffline  = errors.New("SIM is offline")
+)
+
 // GetSIM gets SIM information for specified SIM ID
 func (c *SoracomClient) GetSIM(simID string) (*models.SIM, error) {
+	return first(searchCoverages(c, func(o *SoracomClient) ([]models.SIM, error) {
+		return single(o.getSIM(simID))
+	}, simKey))
+}
+
+func (c *SoracomClient) getSIM(simID string) (*models.SIM, error) {
 	res, err := c.callAPI(&apiParams{
 		method: "GET",
 		path:   fmt.Sprintf("query/sims?limit=1&sim_id=%s", simID),
@@ -175,33 +540,175 @@ func (c *SoracomClient) GetSIM(simID string) (*models.SIM, error) {
 	}
 
 	var sims []models.SIM
-	err = json.NewDecoder(res.Body).Decode(&sims)
+	err = decodeResponse(res, &sims)
 
 	if len(sims) == 0 {
-		return nil, fmt.Errorf("SIM not found: %s", simID)
+		return nil, fmt.Errorf("%w: %s", ErrSIMNotFound, simID)
 	}
 
 	return &sims[0], err
 }
 
-// ListPortMappings finds all port mappings
-func (c *SoracomClient) ListPortMappings() ([]models.PortMapping, error) {
+// FindSIMByIMSI finds the SIM which has the subscriber with specified IMSI
+func (c *SoracomClient) FindSIMByIMSI(imsi string) (*models.SIM, error) {
+	return first(searchCoverages(c, func(o *SoracomClient) ([]models.SIM, error) {
+		return single(o.findSIMByIMSI(imsi))
+	}, simKey))
+}
+
+func (c *SoracomClient) findSIMByIMSI(imsi string) (*models.SIM, error) {
+	sims, err := queryAll[models.SIM](c, fmt.Sprintf("query/sims?limit=100&imsi=%s", url.QueryEscape(imsi)))
+	if err != nil {
+		return nil, err
+	}
+
+	// the query API matches IMSI partially
+	for i, s := range sims {
+		for _, p := range s.Profiles {
+			for _, sub := range p.Subscribers {
+				if sub.Imsi == imsi {
+					return &sims[i], nil
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: IMSI %s", ErrSIMNotFound, imsi)
+}
+
+// GetOnlineSIM gets the SIM with specified SIM ID, and returns an error
+// wrapping ErrSIMOffline if it is offline
+func (c *SoracomClient) GetOnlineSIM(simID string) (*models.SIM, error) {
+	sim, err := c.GetSIM(simID)
+	if err != nil {
+		return nil, err
+	}
+	return checkOnline(sim)
+}
+
+// FindOnlineSIMByIMSI finds the SIM which has the subscriber with specified
+// IMSI, and returns an error wrapping ErrSIMOffline if it is offline
+func (c *SoracomClient) FindOnlineSIMByIMSI(imsi string) (*models.SIM, error) {
+	sim, err := c.FindSIMByIMSI(imsi)
+	if err != nil {
+		return nil, err
+	}
+	return checkOnline(sim)
+}
+
+// checkOnline returns the SIM if it is online, or an error otherwise
+func checkOnline(sim *models.SIM) (*models.SIM, error) {
+	if !sim.SessionStatus.Online {
+		return nil, fmt.Errorf("%w: %s", ErrSIMOffline, sim)
+	}
+	return sim, nil
+}
+
+// GetSubscriber gets the subscriber with specified IMSI. Returns an error
+// wrapping ErrSIMNotFound if not found, as the methods which look up a SIM.
+func (c *SoracomClient) GetSubscriber(imsi string) (*models.Subscriber, error) {
+	return first(searchCoverages(c, func(o *SoracomClient) ([]models.Subscriber, error) {
+		return single(o.getSubscriber(imsi))
+	}, subscriberKey))
+}
+
+func (c *SoracomClient) getSubscriber(imsi string) (*models.Subscriber, error) {
 	res, err := c.callAPI(&apiParams{
 		method: "GET",
-		path:   "port_mappings",
+		path:   fmt.Sprintf("subscribers/%s", url.PathEscape(imsi)),
 		body:   "",
 	})
+	if errors.Is(err, &APIError{StatusCode: http.StatusNotFound}) {
+		return nil, fmt.Errorf("%w: IMSI %s", ErrSIMNotFound, imsi)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	var portMapping []models.PortMapping
-	err = json.NewDecoder(res.Body).Decode(&portMapping)
-	return portMapping, err
+	var subscriber models.Subscriber
+	err = decodeResponse(res, &subscriber)
+	return &subscriber, err
+}
+
+// FindSubscribersByName finds subscribers which has the specified name,
+// following X-Soracom-Next-Key header as FindSIMsByName. Unlike the query API
+// of SIMs, the name must match exactly.
+func (c *SoracomClient) FindSubscribersByName(name string) ([]models.Subscriber, error) {
+	return searchCoverages(c, func(o *SoracomClient) ([]models.Subscriber, error) {
+		return o.findSubscribersByName(name)
+	}, subscriberKey)
+}
+
+func (c *SoracomClient) findSubscribersByName(name string) ([]models.Subscriber, error) {
+	return queryAll[models.Subscriber](c, fmt.Sprintf("subscribers?limit=100&tag_name=name&tag_value=%s&tag_value_match_mode=exact", url.QueryEscape(name)))
+}
+
+// ListPortMappings finds all port mappings
+func (c *SoracomClient) ListPortMappings() ([]models.PortMapping, error) {
+	var portMappings []models.PortMapping
+	err := c.ListPortMappingsFunc(func(pm models.PortMapping) error {
+		portMappings = append(portMappings, pm)
+		return nil
+	})
+	return portMappings, err
+}
+
+// ListPortMappingsFunc calls fn for each port mapping as it is decoded,
+// following X-Soracom-Next-Key header to get all pages, so that callers can
+// process many port mappings without holding all of them. Stops and returns
+// the error if fn returns non-nil.
+func (c *SoracomClient) ListPortMappingsFunc(fn func(models.PortMapping) error) error {
+	if err := c.listPortMappingsFunc(fn); err != nil {
+		return err
+	}
+	for _, o := range c.otherClients() {
+		var fnErr error
+		err := o.listPortMappingsFunc(func(pm models.PortMapping) error {
+			c.remember(pm.Destination.ID, o)
+			fnErr = fn(pm)
+			return fnErr
+		})
+		if fnErr != nil {
+			return fnErr
+		}
+		if err != nil {
+			c.Logger.Debug("failed to list port mappings on coverage type", "coverageType", o.coverageType, "error", err)
+		}
+	}
+	return nil
+}
+
+func (c *SoracomClient) listPortMappingsFunc(fn func(models.PortMapping) error) error {
+	var lastEvaluatedKey string
+	for {
+		p := "port_mappings?limit=100"
+		if lastEvaluatedKey != "" {
+			p = fmt.Sprintf("%s&last_evaluated_key=%s", p, url.QueryEscape(lastEvaluatedKey))
+		}
+		res, err := c.callAPI(&apiParams{
+			method: "GET",
+			path:   p,
+			body:   "",
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := decodeEach(res, fn); err != nil {
+			return err
+		}
+
+		lastEvaluatedKey = res.Header.Get("X-Soracom-Next-Key")
+		if lastEvaluatedKey == "" {
+			return nil
+		}
+	}
 }
 
 // FindPortMappingsForSIM finds port mappings for specified SIM
 func (c *SoracomClient) FindPortMappingsForSIM(sim models.SIM) ([]models.PortMapping, error) {
+	if o := c.clientFor(sim.ID); o != c {
+		return o.FindPortMappingsForSIM(sim)
+	}
 	res, err := c.callAPI(&apiParams{
 		method: "GET",
 		path:   fmt.Sprintf("port_mappings/sims/%s", sim.ID),
@@ -212,12 +719,32 @@ func (c *SoracomClient) FindPortMappingsForSIM(sim models.SIM) ([]models.PortMap
 	}
 
 	var portMapping []models.PortMapping
-	err = json.NewDecoder(res.Body).Decode(&portMapping)
+	err = decodeResponse(res, &portMapping)
 	return portMapping, err
 }
 
-// FindAvailablePortMappingsForSIM finds available port mappings for specified SIM and port
-func (c *SoracomClient) FindAvailablePortMappingsForSIM(sim models.SIM, port int) ([]models.PortMapping, error) {
+// FindPortMappingsForSubscriber finds port mappings for specified subscriber
+func (c *SoracomClient) FindPortMappingsForSubscriber(subscriber models.Subscriber) ([]models.PortMapping, error) {
+	if o := c.clientFor(subscriber.IMSI); o != c {
+		return o.FindPortMappingsForSubscriber(subscriber)
+	}
+	res, err := c.callAPI(&apiParams{
+		method: "GET",
+		path:   fmt.Sprintf("port_mappings/subscribers/%s", url.PathEscape(subscriber.IMSI)),
+		body:   "",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var portMappings []models.PortMapping
+	err = decodeResponse(res, &portMappings)
+	return portMappings, err
+}
+
+// FindAvailablePortMappingsForSIM finds available port mappings for specified
+// SIM and port, whose TLS requirement matches tlsRequired
+func (c *SoracomClient) FindAvailablePortMappingsForSIM(sim models.SIM, port int, tlsRequired bool) ([]models.PortMapping, error) {
 	portMappings, err := c.FindPortMappingsForSIM(sim)
 	if err != nil {
 		return nil, err
@@ -227,26 +754,24 @@ func (c *SoracomClient) FindAvailablePortMappingsForSIM(sim models.SIM, port int
 	var availablePortMappings []models.PortMapping
 
 	for _, pm := range portMappings {
-		if pm.Destination.Port == port {
+		if pm.Destination.Port == port && pm.TLSRequired == tlsRequired {
 			currentPortMappings = append(currentPortMappings, pm)
 		}
 	}
 
 	if len(currentPortMappings) > 0 {
-		fmt.Printf("nssh: → found %d port mapping(s) for %s:%d\n", len(currentPortMappings), sim.ID, port)
-		ip, err := GetIP()
+		c.Emitter.Emit("port_mappings_found", map[string]any{"simId": sim.ID, "port": port, "count": len(currentPortMappings)}, "→ found %d port mapping(s) for %s:%d", len(currentPortMappings), sim.ID, port)
+		ip, err := c.CheckIP.GetIP()
+		if err != nil { // ignore the error, and create new port mapping
+			c.Emitter.Emit("ip_address_unknown", map[string]any{"error": err}, "→ failed to determine current IP address: %v", err)
+		}
 
 		// search port mappings which allows being connected from current IP address
-		if err == nil { // ignore https://checkip.amazonaws.com/ error
-			fmt.Printf("nssh: → check allowed CIDR for current IP address is %s\n", ip)
+		if err == nil {
+			c.Emitter.Emit("ip_address_found", map[string]any{"ipAddress": ip.String()}, "→ check allowed CIDR for current IP address is %s", ip)
 			for _, pm := range currentPortMappings {
-				for _, r := range pm.Source.IPRanges {
-					_, ipNet, err := net.ParseCIDR(r)
-					if err == nil {
-						if ipNet.Contains(ip) {
-							availablePortMappings = append(availablePortMappings, pm)
-						}
-					}
+				if pm.AllowsIP(ip) {
+					availablePortMappings = append(availablePortMappings, pm)
 				}
 			}
 		}
@@ -254,9 +779,71 @@ func (c *SoracomClient) FindAvailablePortMappingsForSIM(sim models.SIM, port int
 	return availablePortMappings, nil
 }
 
+// range of duration of port mappings in minutes, which SORACOM Napter accepts
+const (
+	MinPortMappingDuration = 1
+	MaxPortMappingDuration = 8 * 60
+)
+
+// ValidatePortMapping returns an error if port is not a valid port number, or
+// duration in minutes is out of the range SORACOM Napter accepts
+func ValidatePortMapping(port, duration int) error {
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("invalid port %d, specify 1-65535", port)
+	}
+	if duration < MinPortMappingDuration || duration > MaxPortMappingDuration {
+		return fmt.Errorf("invalid duration %d, specify %d-%d minutes", duration, MinPortMappingDuration, MaxPortMappingDuration)
+	}
+	return nil
+}
+
+// ResolveSourceCIDRs validates sourceCIDRs, and returns them as is, or the CIDR
+// of current global IP address if sourceCIDRs is empty. Returns empty if the
+// address cannot be determined, i.e. SORACOM API default is used.
+func (c *SoracomClient) ResolveSourceCIDRs(sourceCIDRs []string) ([]string, error) {
+	for _, r := range sourceCIDRs {
+		if _, _, err := net.ParseCIDR(r); err != nil {
+			return nil, fmt.Errorf("invalid source CIDR: %s", r)
+		}
+	}
+	if len(sourceCIDRs) > 0 {
+		return sourceCIDRs, nil
+	}
+
+	ip, err := c.CheckIP.GetIP()
+	if err != nil {
+		c.Emitter.Emit("ip_address_unknown", map[string]any{"error": err}, "→ failed to determine current IP address, no source CIDR is specified: %v", err)
+		return nil, nil
+	}
+	return []string{hostCIDR(ip)}, nil
+}
+
 // CreatePortMappingForSIM creates port mappings for specified
-// subscriber, port, and duration
-func (c *SoracomClient) CreatePortMappingForSIM(sim models.SIM, port, duration int) (*models.PortMapping, error) {
+// subscriber, port, duration, and TLS requirement, which permits connections only from
+// sourceCIDRs. If sourceCIDRs is empty, only current global IP address is
+// permitted, or SORACOM API default is used if the address cannot be
+// determined.
+func (c *SoracomClient) CreatePortMappingForSIM(sim models.SIM, port, duration int, sourceCIDRs []string, tlsRequired bool) (*models.PortMapping, error) {
+	if o := c.clientFor(sim.ID); o != c {
+		return o.CreatePortMappingForSIM(sim, port, duration, sourceCIDRs, tlsRequired)
+	}
+	if err := ValidatePortMapping(port, duration); err != nil {
+		return nil, err
+	}
+
+	sourceCIDRs, err := c.ResolveSourceCIDRs(sourceCIDRs)
+	if err != nil {
+		return nil, err
+	}
+
+	type source struct {
+		IPRanges []string `json:"ipRanges"`
+	}
+	var src *source
+	if len(sourceCIDRs) > 0 {
+		src = &source{IPRanges: sourceCIDRs}
+	}
+
 	body, err := json.Marshal(struct {
 		Duration    int  `json:"duration"`
 		TLSRequired bool `json:"tlsRequired"`
@@ -264,9 +851,10 @@ func (c *SoracomClient) CreatePortMappingForSIM(sim models.SIM, port, duration i
 			ID   string `json:"simId"`
 			Port int    `json:"port"`
 		} `json:"destination"`
+		Source *source `json:"source,omitempty"`
 	}{
 		Duration:    duration * 60,
-		TLSRequired: false,
+		TLSRequired: tlsRequired,
 		Destination: struct {
 			ID   string `json:"simId"`
 			Port int    `json:"port"`
@@ -274,6 +862,7 @@ func (c *SoracomClient) CreatePortMappingForSIM(sim models.SIM, port, duration i
 			ID:   sim.ID,
 			Port: port,
 		},
+		Source: src,
 	})
 	if err != nil {
 		return nil, err
@@ -289,28 +878,115 @@ func (c *SoracomClient) CreatePortMappingForSIM(sim models.SIM, port, duration i
 	}
 
 	var portMapping models.PortMapping
-	err = json.NewDecoder(res.Body).Decode(&portMapping)
-	return &portMapping, err
+	err = decodeResponse(res, &portMapping)
+	if err != nil {
+		return nil, err
+	}
+	if portMapping.CreatedTime == 0 {
+		portMapping.CreatedTime = time.Now().UnixMilli()
+	}
+	return &portMapping, nil
 }
 
-// Connect connects to specified port mapping with login name and identity. If
-// identity is specified, use it for public key authentication. If not, use
-// password authentication instead.
-func (c *SoracomClient) Connect(login, identity string, portMapping *models.PortMapping) error {
-	sshConfig, err := newSSHClientConfig(login, identity)
+// EnsurePortMapping finds an available port mapping for the SIM, port and TLS
+// requirement, or creates new one as CreatePortMappingForSIM. Returns true
+// with the port mapping if it is created by this call.
+func (c *SoracomClient) EnsurePortMapping(sim models.SIM, port, duration int, sourceCIDRs []string, tlsRequired bool) (*models.PortMapping, bool, error) {
+	c.Emitter.Emit("port_mappings_searching", map[string]any{"simId": sim.ID, "port": port}, "search existing port mappings for %s:%d", sim.ID, port)
+	available, err := c.FindAvailablePortMappingsForSIM(sim, port, tlsRequired)
+	if err == nil && len(available) > 0 {
+		portMapping := &available[0]
+		c.Emitter.Emit("port_mapping_found", map[string]any{"simId": sim.ID, "endpoint": portMapping.Endpoint}, "→ found available port mapping:\n%s", portMapping)
+		return portMapping, false, nil
+	}
+
+	done := c.Emitter.Progress("port_mapping_creating", map[string]any{"simId": sim.ID, "port": port}, "→ no existing port mapping for %s:%d, creating", sim.ID, port)
+	portMapping, err := c.CreatePortMappingForSIM(sim, port, duration, sourceCIDRs, tlsRequired)
+	done(err)
+	if err != nil {
+		return nil, false, err
+	}
+	c.Emitter.Emit("port_mapping_created", map[string]any{"simId": sim.ID, "endpoint": portMapping.Endpoint, "sourceCIDRs": portMapping.Source.IPRanges}, "")
+	return portMapping, true, nil
+}
+
+// DeletePortMapping deletes specified port mapping
+func (c *SoracomClient) DeletePortMapping(portMapping *models.PortMapping) error {
+	if o := c.clientFor(portMapping.Destination.ID); o != c {
+		return o.DeletePortMapping(portMapping)
+	}
+	res, err := c.callAPI(&apiParams{
+		method: "DELETE",
+		path:   fmt.Sprintf("port_mappings/%s/%d", portMapping.IPAddress, portMapping.Port),
+		body:   "",
+	})
 	if err != nil {
 		return err
 	}
+	closeResponse(res)
+	return nil
+}
+
+// window size is notified after no resize event for this duration
+const resizeDebounce = 100 * time.Millisecond
+
+// ConnectOptions represents optional settings for Connect, Dial and Shell
+type ConnectOptions struct {
+	TLSInsecure         bool          // skip verification of the certificate of TLS required port mapping
+	ServerAliveInterval time.Duration // interval to send keepalive requests, 0 to disable
+	ServerAliveCountMax int           // number of unanswered keepalive requests to disconnect
+	ExpiryWarning       time.Duration // warn this long before the port mapping expires, 0 to disable
+	Term                string        // terminal type of the PTY, TERM environment variable or "xterm" if empty
+	NoPTY               bool          // do not allocate PTY, which is implied if stdin or stdout is not a terminal
+	IdentityPEM         []byte        // PEM encoded private key used instead of identity file, if not empty
+	Password            string        // password used instead of asking when neither identity nor IdentityPEM is specified, if not empty
+	Certificate         string        // path to OpenSSH certificate of the private key, if any
+	Timings             *Timings      // records duration of TCP dial, TLS and SSH handshake, if not nil
+	SessionLog          io.Writer     // receives a copy of the remote output while it is displayed, e.g. SessionLog, if not nil
+	SessionLogInput     bool          // also copy stdin, i.e. keystrokes, to SessionLog
+	Ciphers             []string      // allowed ciphers in order of preference, one of SupportedCiphers. Modern defaults if empty
+	MACs                []string      // allowed MAC algorithms in order of preference, one of SupportedMACs. Modern defaults if empty
+	KeyExchanges        []string      // allowed key exchange algorithms in order of preference, one of SupportedKeyExchanges. Modern defaults if empty
+	Timeout             time.Duration // timeout of TCP dial, TLS and SSH handshake, 0 to wait forever
+	AgentOnly           bool          // authenticate only with keys of the SSH agent at SSH_AUTH_SOCK, never with identity, IdentityPEM nor password
+	Title               string        // window title of the local terminal during the session with PTY, e.g. the name of the SIM, if not empty
+	Usage               *Usage        // counts bytes sent to and received from the shell, if not nil
+
+	// Dialer connects to the port mapping, e.g. Dial of ssh.Client of a jump
+	// host. net.Dial is used if nil.
+	Dialer func(network, addr string) (net.Conn, error)
+}
 
-	client, err := ssh.Dial("tcp", portMapping.Endpoint, sshConfig)
+// Connect connects to specified port mapping with login name and identity. If
+// identity is specified, use it for public key authentication. If not, use
+// password authentication instead.
+func (c *SoracomClient) Connect(login, identity string, portMapping *models.PortMapping, opts ConnectOptions) error {
+	client, err := c.Dial(login, identity, portMapping, opts)
 	if err != nil {
 		return err
 	}
+	c.Emitter.Emit("connected", map[string]any{"login": login, "endpoint": portMapping.Endpoint}, "")
 
+	defer func() {
+		err := client.Close()
+		if err != nil {
+			// do nothing
+		}
+	}()
+
+	return c.Shell(client, portMapping, opts)
+}
+
+// Shell opens a shell in new session of client established by Dial, with PTY
+// unless opts.NoPTY is set or stdin or stdout is not a terminal, and waits for
+// it to exit. portMapping is used to warn before it expires.
+func (c *SoracomClient) Shell(client *ssh.Client, portMapping *models.PortMapping, opts ConnectOptions) error {
 	session, err := client.NewSession()
 	if err != nil {
 		return err
 	}
+	opts.Usage.begin()
+	defer opts.Usage.finish()
 
 	defer func() {
 		err := session.Close()
@@ -319,18 +995,28 @@ func (c *SoracomClient) Connect(login, identity string, portMapping *models.Port
 		}
 	}()
 
+	if opts.NoPTY || !terminal.IsTerminal(int(os.Stdin.Fd())) || !terminal.IsTerminal(int(os.Stdout.Fd())) {
+		c.Logger.Debug("run shell without PTY")
+		return runWithoutPTY(session, opts)
+	}
+
 	fd := int(os.Stdin.Fd())
-	state, err := terminal.MakeRaw(fd)
+	modes := terminalModes(fd)
+	err = makeRaw(fd)
 	if err != nil {
 		return err
 	}
 
 	defer func() {
-		err := terminal.Restore(fd, state)
+		err := RestoreTerminal()
 		if err != nil {
 			fmt.Println("failed to restore terminal", err)
 		}
 	}()
+	if opts.Title != "" {
+		// restored with the terminal
+		setTitle(opts.Title)
+	}
 
 	w, h, err := terminal.GetSize(fd)
 	if err != nil {
@@ -339,11 +1025,7 @@ func (c *SoracomClient) Connect(login, identity string, portMapping *models.Port
 		h = 24
 	}
 
-	err = session.RequestPty("xterm", h, w, ssh.TerminalModes{
-		ssh.ECHO:          1,
-		ssh.TTY_OP_ISPEED: 14400,
-		ssh.TTY_OP_OSPEED: 14400,
-	})
+	err = session.RequestPty(terminalType(opts.Term), h, w, modes)
 	if err != nil {
 		return err
 	}
@@ -352,19 +1034,27 @@ func (c *SoracomClient) Connect(login, identity string, portMapping *models.Port
 	if err != nil {
 		return fmt.Errorf("failed to setup stdin for session: %v", err)
 	}
-	go dup(stdin, os.Stdin)
+	go dup(stdin, opts.teeInput(os.Stdin), session)
 
 	stdout, err := session.StdoutPipe()
 	if err != nil {
 		return fmt.Errorf("failed to setup stdout for session: %v", err)
 	}
-	go dup(os.Stdout, stdout)
+	go dup(opts.teeOutput(os.Stdout), stdout, session)
 
 	stderr, err := session.StderrPipe()
 	if err != nil {
 		return fmt.Errorf("failed to setup stderr for session: %v", err)
 	}
-	go dup(os.Stderr, stderr)
+	go dup(opts.teeOutput(os.Stderr), stderr, session)
+
+	if expiresAt, ok := portMapping.ExpiresAt(); ok && opts.ExpiryWarning > 0 {
+		// the terminal is in raw mode, so return the carriage explicitly
+		timer := time.AfterFunc(time.Until(expiresAt.Add(-opts.ExpiryWarning)), func() {
+			fmt.Fprintf(os.Stderr, "\r\nnssh: the port mapping expires at %s, in %s\r\n", expiresAt.Format(time.Kitchen), time.Until(expiresAt).Round(time.Second))
+		})
+		defer timer.Stop()
+	}
 
 	err = session.Shell()
 	if err != nil {
@@ -373,26 +1063,347 @@ func (c *SoracomClient) Connect(login, identity string, portMapping *models.Port
 
 	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, SIGWINCH)
-	go func() {
-		for {
-			s := <-ch
-			switch s {
-			case SIGWINCH:
-				fd := int(os.Stdout.Fd())
-				w, h, _ = terminal.GetSize(fd)
-				err := session.WindowChange(h, w)
-				if err != nil {
-					fmt.Println("failed to change window size", err)
-				}
-			}
+	defer signal.Stop(ch)
+	done := make(chan struct{})
+	defer close(done)
+	go watchWindowSize(session, w, h, ch, done)
+
+	return waitSession(session)
+}
+
+// ErrConnectionLost is returned by Connect and Shell if the session ends without exit
+// status of the remote shell, e.g. when the connection drops
+var ErrConnectionLost = errors.New("connection lost")
+
+// ErrUnreachable is returned by Dial, Connect and Run if the SSH server of the
+// device cannot be reached, e.g. nothing listens on the port or the port
+// mapping has expired
+var ErrUnreachable = errors.New("failed to reach the SSH server")
+
+// ErrAuthFailed is returned by Dial, Connect and Run if the device rejects
+// all the authentication methods, e.g. wrong user, key or password
+var ErrAuthFailed = errors.New("SSH authentication failed")
+
+// waitSession waits for the remote shell to exit, and wraps the error with
+// ErrConnectionLost unless the shell exited
+func waitSession(session *ssh.Session) error {
+	err := session.Wait()
+	var exitError *ssh.ExitError
+	if err == nil || errors.As(err, &exitError) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrConnectionLost, err)
+}
+
+// Run runs command on specified port mapping with login name and identity,
+// without PTY, and writes its output to stdout and stderr. Returns
+// *ssh.ExitError if the command exits with non-zero status.
+func (c *SoracomClient) Run(login, identity string, portMapping *models.PortMapping, command string, stdout, stderr io.Writer, opts ConnectOptions) error {
+	client, err := c.Dial(login, identity, portMapping, opts)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = session.Close()
+	}()
+
+	session.Stdout = stdout
+	session.Stderr = stderr
+	return session.Run(command)
+}
+
+// RunScript uploads script to a temporary file on the device, and runs it
+// with args like Run. The file is removed after running it, even if it fails.
+func (c *SoracomClient) RunScript(login, identity string, portMapping *models.PortMapping, script []byte, args []string, stdout, stderr io.Writer, opts ConnectOptions) error {
+	client, err := c.Dial(login, identity, portMapping, opts)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+
+	path, err := uploadScript(client, script)
+	if err != nil {
+		return fmt.Errorf("failed to upload the script: %w", err)
+	}
+	c.Logger.Debug("uploaded script", "path", path, "size", len(script))
+	defer func() {
+		if err := runSession(client, "rm -f "+shellQuote(path), nil, nil, nil); err != nil {
+			c.Logger.Warn("failed to remove the script", "path", path, "error", err)
 		}
 	}()
 
-	err = session.Wait()
+	command := shellQuote(path)
+	for _, arg := range args {
+		command += " " + shellQuote(arg)
+	}
+	return runSession(client, command, nil, stdout, stderr)
+}
+
+// uploadScript writes script to an executable temporary file on the device,
+// and returns its path
+func uploadScript(client *ssh.Client, script []byte) (string, error) {
+	var out bytes.Buffer
+	err := runSession(client, `f=$(mktemp "${TMPDIR:-/tmp}/nssh.XXXXXX") && cat > "$f" && chmod 700 "$f" && echo "$f"`, bytes.NewReader(script), &out, nil)
+	if err != nil {
+		return "", err
+	}
+	path := strings.TrimSpace(out.String())
+	if path == "" {
+		return "", errors.New("no path of the temporary file")
+	}
+	return path, nil
+}
+
+// runSession runs command in new session of client with specified stdio
+func runSession(client *ssh.Client, command string, stdin io.Reader, stdout, stderr io.Writer) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = session.Close()
+	}()
+
+	session.Stdin = stdin
+	session.Stdout = stdout
+	session.Stderr = stderr
+	return session.Run(command)
+}
+
+// shellQuote quotes s for POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// runWithoutPTY runs the shell with stdio as is, e.g. for pipelines. The remote
+// shell exits when stdin is closed.
+func runWithoutPTY(session *ssh.Session, opts ConnectOptions) error {
+	session.Stdin = opts.teeInput(os.Stdin)
+	session.Stdout = opts.teeOutput(os.Stdout)
+	session.Stderr = opts.teeOutput(os.Stderr)
+
+	if err := session.Shell(); err != nil {
+		return err
+	}
+	return waitSession(session)
+}
+
+// teeOutput returns w which also writes to SessionLog, if any, and counts the
+// output to Usage. w is written first, not to delay the output with the log.
+func (opts ConnectOptions) teeOutput(w io.Writer) io.Writer {
+	w = opts.Usage.countWriter(w)
+	if opts.SessionLog == nil {
+		return w
+	}
+	return io.MultiWriter(w, opts.SessionLog)
+}
+
+// teeInput returns r which also writes what is read to SessionLog, if
+// SessionLogInput is set, and counts the input to Usage
+func (opts ConnectOptions) teeInput(r io.Reader) io.Reader {
+	r = opts.Usage.countReader(r)
+	if opts.SessionLog == nil || !opts.SessionLogInput {
+		return r
+	}
+	return io.TeeReader(r, opts.SessionLog)
+}
+
+// watchWindowSize notifies new window size to the session on SIGWINCH from ch,
+// until done is closed. Rapid resize events are debounced, not to make
+// full screen applications redraw repeatedly with intermediate sizes.
+func watchWindowSize(session *ssh.Session, w, h int, ch <-chan os.Signal, done <-chan struct{}) {
+	defer recoverSession(session)
+
+	timer := time.NewTimer(resizeDebounce)
+	timer.Stop()
+	for {
+		select {
+		case <-done:
+			timer.Stop()
+			return
+		case <-ch:
+			timer.Reset(resizeDebounce)
+		case <-timer.C:
+			nw, nh, err := terminal.GetSize(int(os.Stdout.Fd()))
+			if err != nil || (nw == w && nh == h) {
+				continue
+			}
+			w, h = nw, nh
+			if err := session.WindowChange(h, w); err != nil {
+				fmt.Println("failed to change window size", err)
+			}
+		}
+	}
+}
+
+// Dial establishes SSH connection to specified port mapping with login name and
+// identity, and returns the client. Authentication method is selected in the
+// same manner as Connect.
+// If the port mapping requires TLS, the connection is wrapped with TLS, and
+// the certificate is verified against the hostname of the port mapping unless
+// opts.TLSInsecure is set.
+func (c *SoracomClient) Dial(login, identity string, portMapping *models.PortMapping, opts ConnectOptions) (*ssh.Client, error) {
+	sshConfig, err := c.newSSHClientConfig(login, identity, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	done := c.Emitter.Progress("ssh_connecting", map[string]any{"endpoint": portMapping.Endpoint}, "→ establish SSH connection to %s", portMapping.Endpoint)
+	client, err := c.dial(portMapping, sshConfig, opts)
+	done(err)
+	return client, err
+}
+
+// dial connects to the port mapping, and performs SSH handshake
+func (c *SoracomClient) dial(portMapping *models.PortMapping, sshConfig *ssh.ClientConfig, opts ConnectOptions) (*ssh.Client, error) {
+	c.Logger.Debug("dial", "endpoint", portMapping.Endpoint, "tls", portMapping.TLSRequired)
+	dial := opts.Dialer
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: opts.Timeout}).Dial
+	}
+	start := time.Now()
+	conn, err := dial("tcp", portMapping.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnreachable, err)
+	}
+	opts.Timings.Record("TCP dial", start)
+	if opts.Timeout > 0 {
+		// cleared after SSH handshake. Not supported by some dialers, e.g. jump host
+		_ = conn.SetDeadline(time.Now().Add(opts.Timeout))
+	}
+
+	if !portMapping.TLSRequired {
+		return c.newSSHClient(conn, portMapping.Endpoint, sshConfig, opts)
+	}
+
+	serverName := portMapping.Hostname
+	if serverName == "" {
+		serverName, _, _ = net.SplitHostPort(portMapping.Endpoint)
+	}
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: opts.TLSInsecure,
+	})
+	start = time.Now()
+	if err := tlsConn.Handshake(); err != nil {
+		_ = conn.Close()
+		return nil, closedError(fmt.Errorf("TLS handshake failed: %w", err))
+	}
+	opts.Timings.Record("TLS handshake", start)
+	c.Logger.Debug("TLS handshake completed", "serverName", serverName, "version", tls.VersionName(tlsConn.ConnectionState().Version))
+
+	return c.newSSHClient(tlsConn, portMapping.Endpoint, sshConfig, opts)
+}
+
+// closedError wraps err of a handshake with ErrUnreachable if the connection
+// is closed or timed out, e.g. as the port mapping has expired or the port is
+// not of SSH server, or returns err as is otherwise
+func closedError(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrUnreachable, err)
+	}
 	return err
 }
 
+// newSSHClient performs SSH handshake over conn, and returns the client which
+// sends keepalive requests as specified by opts. conn is closed if the
+// handshake fails.
+func (c *SoracomClient) newSSHClient(conn net.Conn, addr string, config *ssh.ClientConfig, opts ConnectOptions) (*ssh.Client, error) {
+	start := time.Now()
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		_ = conn.Close()
+		if strings.Contains(err.Error(), "unable to authenticate") {
+			return nil, fmt.Errorf("%w as %s: %w", ErrAuthFailed, config.User, err)
+		}
+		return nil, closedError(err)
+	}
+	opts.Timings.Record("SSH handshake", start)
+	_ = conn.SetDeadline(time.Time{})
+	c.Logger.Debug("SSH handshake completed",
+		"serverVersion", string(sshConn.ServerVersion()),
+		"clientVersion", string(sshConn.ClientVersion()),
+		"user", sshConn.User())
+
+	client := ssh.NewClient(sshConn, chans, reqs)
+	if opts.ServerAliveInterval > 0 {
+		done := make(chan struct{})
+		go func() {
+			_ = client.Wait()
+			close(done)
+		}()
+		go c.keepAlive(client, opts.ServerAliveInterval, opts.ServerAliveCountMax, done)
+	}
+	return client, nil
+}
+
+// keepAlive sends keepalive request every interval until done is closed, like
+// ServerAliveInterval of OpenSSH, and closes the client if countMax requests
+// in a row are not answered
+func (c *SoracomClient) keepAlive(client *ssh.Client, interval time.Duration, countMax int, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	failures := 0
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		errc := make(chan error, 1)
+		go func() {
+			// servers which don't know the request reply with failure, which
+			// is enough to know the connection is alive
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			errc <- err
+		}()
+
+		select {
+		case <-done:
+			return
+		case err := <-errc:
+			if err == nil {
+				failures = 0
+				continue
+			}
+		case <-time.After(interval):
+		}
+
+		failures++
+		c.Logger.Debug("keepalive failed", "failures", failures)
+		if failures >= countMax {
+			fmt.Fprintf(os.Stderr, "\r\nnssh: no response from server for %d keepalive requests, disconnecting\r\n", failures)
+			_ = client.Close()
+			return
+		}
+	}
+}
+
+// hostCIDR returns CIDR which contains only the ip, i.e. /32 for IPv4 and /128
+// for IPv6
+func hostCIDR(ip net.IP) string {
+	if ip.To4() != nil {
+		return ip.String() + "/32"
+	}
+	return ip.String() + "/128"
+}
+
 func readPassword(prompt string) (string, error) {
+	if !terminal.IsTerminal(int(syscall.Stdin)) {
+		return "", errors.New("cannot read password as stdin is not a terminal, use public key authentication")
+	}
 	fmt.Print(prompt)
 	// cast syscall.Stdin to int looks redundant, but it is necessary to
 	// compile on Windows
@@ -400,68 +1411,100 @@ func readPassword(prompt string) (string, error) {
 	return string(password), err
 }
 
-func dup(dst io.Writer, src io.Reader) {
+// dup copies src to dst. A panic while copying closes the session, see
+// recoverSession.
+func dup(dst io.Writer, src io.Reader, session *ssh.Session) {
+	defer recoverSession(session)
 	_, err := io.Copy(dst, src)
 	if err != nil {
 		fmt.Println("failed to copy stdin", err)
 	}
 }
 
-func getEndpoint(coverageType string) (string, error) {
-	if strings.HasPrefix(coverageType, "j") {
-		return "https://api.soracom.io", nil
-	} else if strings.HasPrefix(coverageType, "g") {
-		return "https://g.api.soracom.io", nil
-	} else {
-		return "", fmt.Errorf("invalid coverage type: %s", coverageType)
+// AutoCoverageType is the coverage type to search SIMs in each of
+// CoverageTypes, e.g. if it is unknown which coverage the device is on
+const AutoCoverageType = "auto"
+
+// CoverageTypes are the coverage types searched in order with AutoCoverageType
+var CoverageTypes = []string{"jp", "g"}
+
+// NormalizeCoverageType returns "g", "jp", "sandbox" or AutoCoverageType for
+// coverageType, accepting "global" and "japan" as aliases, case-insensitive
+func NormalizeCoverageType(coverageType string) (string, error) {
+	switch strings.ToLower(coverageType) {
+	case "g", "global":
+		return "g", nil
+	case "jp", "japan":
+		return "jp", nil
+	case "sandbox":
+		return "sandbox", nil
+	case AutoCoverageType:
+		return AutoCoverageType, nil
+	default:
+		return "", fmt.Errorf("invalid coverage type: %s, specify one of g (or global), jp (or japan), sandbox, auto", coverageType)
 	}
 }
 
-func getAuthInfoFromProfile(profileName string) (string, string, string, error) {
-	dir, err := getProfileDir()
-	if err != nil {
-		return "", "", "", err
+// getEndpoint returns the endpoint of the normalized coverage type
+func getEndpoint(coverageType string) string {
+	switch coverageType {
+	case "sandbox":
+		return "https://api-sandbox.soracom.io"
+	case "g":
+		return "https://g.api.soracom.io"
+	default:
+		return "https://api.soracom.io"
 	}
-	path := filepath.Join(dir, profileName+".json")
+}
 
-	b, err := os.ReadFile(path)
-	if err != nil {
-		return "", "", "", err
+// validateEndpoint returns an error if endpoint is not an https URL without
+// path, as the path of each API is appended to it
+func validateEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "https" || u.Host == "" || u.Path != "" || u.RawQuery != "" {
+		return fmt.Errorf("invalid endpoint: %s, specify https URL such as https://api.soracom.io", endpoint)
 	}
-
-	p := struct {
-		AuthKeyID    *string `json:"authKeyId"`
-		AuthKey      *string `json:"authKey"`
-		CoverageType *string `json:"coverageType"`
-	}{}
-	err = json.Unmarshal(b, &p)
-	return *p.AuthKeyID, *p.AuthKey, *p.CoverageType, err
+	return nil
 }
 
-func getProfileDir() (string, error) {
-	profileDir := os.Getenv("SORACOM_PROFILE_DIR")
-
-	if profileDir == "" {
-		dir, err := homedir.Dir()
-		if err != nil {
-			return "", err
-		}
-		profileDir = filepath.Join(dir, ".soracom")
+func (c *SoracomClient) newSSHClientConfig(login string, identity string, opts ConnectOptions) (*ssh.ClientConfig, error) {
+	if err := ValidateAlgorithms(opts.Ciphers, opts.MACs, opts.KeyExchanges); err != nil {
+		return nil, err
 	}
 
-	return profileDir, nil
-}
-
-func newSSHClientConfig(login string, identity string) (*ssh.ClientConfig, error) {
 	var am ssh.AuthMethod
+	var key ssh.Signer
+	var err error
 
-	if identity == "" {
-		password, err := readPassword("nssh: password: ")
+	if opts.AgentOnly {
+		if identity != "" || len(opts.IdentityPEM) > 0 || opts.Certificate != "" {
+			return nil, errors.New("neither private key nor certificate can be specified in agent-only mode, add them to the SSH agent with ssh-add")
+		}
+		am, err = c.agentAuthMethod()
 		if err != nil {
 			return nil, err
 		}
-		am = ssh.Password(password)
-		fmt.Println("")
+	} else if len(opts.IdentityPEM) > 0 {
+		key, err = ssh.ParsePrivateKey(opts.IdentityPEM)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		c.Logger.Debug("use public key authentication", "user", login, "identity", "(PEM)", "type", key.PublicKey().Type())
+	} else if identity == "" {
+		if opts.Certificate != "" {
+			return nil, errors.New("certificate requires the private key, specify identity")
+		}
+		c.Logger.Debug("use password authentication", "user", login, "prompt", opts.Password == "")
+		if opts.Password != "" {
+			am = ssh.Password(opts.Password)
+		} else {
+			password, err := readPassword("nssh: password: ")
+			if err != nil {
+				return nil, err
+			}
+			am = ssh.Password(password)
+			fmt.Println("")
+		}
 	} else {
 		_, err := os.Stat(identity)
 		if err != nil {
@@ -473,21 +1516,124 @@ func newSSHClientConfig(login string, identity string) (*ssh.ClientConfig, error
 			return nil, err
 		}
 
-		key, err := ssh.ParsePrivateKey(buf)
+		key, err = ssh.ParsePrivateKey(buf)
 		if err != nil {
 			return nil, err
 		}
+		c.Logger.Debug("use public key authentication", "user", login, "identity", identity, "type", key.PublicKey().Type())
+	}
+
+	if key != nil {
+		if opts.Certificate != "" {
+			key, err = c.certSigner(key, opts.Certificate)
+			if err != nil {
+				return nil, err
+			}
+		}
 		am = ssh.PublicKeys(key)
 	}
 
 	return &ssh.ClientConfig{
-		User:            login,
-		Auth:            []ssh.AuthMethod{am},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Config: ssh.Config{
+			Ciphers:      opts.Ciphers,
+			MACs:         opts.MACs,
+			KeyExchanges: opts.KeyExchanges,
+		},
+		User:    login,
+		Auth:    []ssh.AuthMethod{am},
+		Timeout: opts.Timeout,
+		BannerCallback: func(message string) error {
+			// some devices show legal or ownership notices
+			if message = strings.TrimRight(message, "\r\n"); message != "" {
+				c.Emitter.Emit("ssh_banner", map[string]any{"banner": message}, "→ banner from the server:\n%s", message)
+			}
+			return nil
+		},
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			c.Logger.Debug("host key", "hostname", hostname, "remote", remote, "type", key.Type(), "fingerprint", ssh.FingerprintSHA256(key))
+			return nil
+		},
 	}, nil
 }
 
+// agentAuthMethod returns public key authentication with the keys of the SSH
+// agent at SSH_AUTH_SOCK. The connection to the agent is kept open, as the
+// agent signs during the handshake.
+func (c *SoracomClient) agentAuthMethod() (ssh.AuthMethod, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, errors.New("SSH_AUTH_SOCK is not set, start ssh-agent and add the key with ssh-add")
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the SSH agent: %w", err)
+	}
+	signers, err := agent.NewClient(conn).Signers()
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to get keys from the SSH agent: %w", err)
+	}
+	if len(signers) == 0 {
+		_ = conn.Close()
+		return nil, errors.New("the SSH agent has no keys, add one with ssh-add")
+	}
+	for _, signer := range signers {
+		c.Logger.Debug("use public key authentication with SSH agent", "type", signer.PublicKey().Type(), "fingerprint", ssh.FingerprintSHA256(signer.PublicKey()))
+	}
+	return ssh.PublicKeys(signers...), nil
+}
+
+// certSigner returns signer which presents OpenSSH certificate at path with
+// key. Warns if the certificate is not valid now, as the server rejects it.
+func (c *SoracomClient) certSigner(key ssh.Signer, path string) (ssh.Signer, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate %s: %w", path, err)
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an OpenSSH certificate", path)
+	}
+
+	now := uint64(time.Now().Unix())
+	if cert.ValidBefore != ssh.CertTimeInfinity && now >= cert.ValidBefore {
+		validBefore := time.Unix(int64(cert.ValidBefore), 0)
+		c.Emitter.Emit("certificate_expired", map[string]any{"path": path, "validBefore": validBefore.Format(time.RFC3339)}, "→ certificate %s expired at %s", path, validBefore.Format(time.RFC3339))
+	} else if now < cert.ValidAfter {
+		validAfter := time.Unix(int64(cert.ValidAfter), 0)
+		c.Emitter.Emit("certificate_not_yet_valid", map[string]any{"path": path, "validAfter": validAfter.Format(time.RFC3339)}, "→ certificate %s is not valid until %s", path, validAfter.Format(time.RFC3339))
+	}
+
+	signer, err := ssh.NewCertSigner(cert, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use certificate %s: %w", path, err)
+	}
+	c.Logger.Debug("use certificate", "path", path, "keyId", cert.KeyId, "principals", cert.ValidPrincipals, "type", cert.Type())
+	return signer, nil
+}
+
 func (c *SoracomClient) callAPI(params *apiParams) (*http.Response, error) {
+	_, token := c.Credentials()
+	res, err := c.call(params)
+
+	// the token might be expired or revoked, so authenticate again and retry
+	// only once, if the auth key is available
+	var apiError *APIError
+	if errors.As(err, &apiError) && (apiError.StatusCode == http.StatusUnauthorized || apiError.StatusCode == http.StatusForbidden) &&
+		c.authKeyID != "" && params.path != "auth" {
+		if err := c.reauthenticate(token); err != nil {
+			return nil, err
+		}
+		return c.call(params)
+	}
+	return res, err
+}
+
+func (c *SoracomClient) call(params *apiParams) (*http.Response, error) {
 	req, err := c.makeRequest(params)
 	if err != nil {
 		return nil, err
@@ -502,38 +1648,149 @@ func (c *SoracomClient) makeRequest(params *apiParams) (*http.Request, error) {
 		body = strings.NewReader(params.body)
 	}
 
-	req, err := http.NewRequest(params.method,
-		fmt.Sprintf("%s/v1/%s", c.Endpoint, params.path),
-		body)
+	u := fmt.Sprintf("%s/%s", c.Endpoint, params.path)
+	if c.apiPrefix != "" {
+		u = fmt.Sprintf("%s/%s/%s", c.Endpoint, c.apiPrefix, params.path)
+	}
+	req, err := http.NewRequest(params.method, u, body)
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-Soracom-Lang", "en")
-	if c.APIKey != "" {
-		req.Header.Set("X-Soracom-Api-Key", c.APIKey)
+	req.Header.Set("X-Soracom-Lang", c.lang)
+	if params.path == "auth" {
+		// the auth handshake is done with the auth key, not with the current token
+		return req, nil
 	}
-	if c.Token != "" {
-		req.Header.Set("X-Soracom-Token", c.Token)
+	apiKey, token := c.Credentials()
+	if apiKey != "" {
+		req.Header.Set("X-Soracom-Api-Key", apiKey)
+	}
+	if token != "" {
+		req.Header.Set("X-Soracom-Token", token)
 	}
 	return req, nil
 }
 
 func (c *SoracomClient) doRequest(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	c.Logger.Info("request", "method", req.Method, "url", req.URL)
+	if req.GetBody != nil && c.Logger.Enabled(ctx, LevelTrace) {
+		if body, err := req.GetBody(); err == nil {
+			b, _ := io.ReadAll(body)
+			c.Logger.Log(ctx, LevelTrace, "request body", "body", redact(b))
+		}
+	}
+
 	res, err := c.Client.Do(req)
 	if err != nil {
 		return nil, err
 	}
+	c.Logger.Info("response", "method", req.Method, "url", req.URL, "status", res.StatusCode)
+
+	if c.Logger.Enabled(ctx, LevelTrace) {
+		b, err := io.ReadAll(res.Body)
+		_ = res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		c.Logger.Log(ctx, LevelTrace, "response body", "body", redact(b))
+		res.Body = io.NopCloser(bytes.NewReader(b))
+	}
 
 	if res.StatusCode >= http.StatusBadRequest {
-		defer func() {
-			err := res.Body.Close()
-			if err != nil {
-				fmt.Println("failed to close response", err)
-			}
-		}()
-		return nil, fmt.Errorf("%s: %s %s", res.Status, req.Method, req.URL)
+		defer closeResponse(res)
+		apiError := &APIError{
+			StatusCode: res.StatusCode,
+			Status:     res.Status,
+			Method:     req.Method,
+			URL:        req.URL,
+		}
+		body := struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		}{}
+		if err := json.NewDecoder(io.LimitReader(res.Body, maxErrorBodySize)).Decode(&body); err == nil {
+			apiError.Code = body.Code
+			apiError.Message = body.Message
+		}
+		return nil, apiError
 	}
 	return res, nil
 }
+
+// maximum size of an error response body to read
+const maxErrorBodySize = 64 * 1024
+
+// decodeResponse decodes JSON body of res into v, and closes the body
+func decodeResponse(res *http.Response, v any) error {
+	defer closeResponse(res)
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// decodeEach decodes JSON array in the body of res element by element, and
+// calls fn for each of them
+func decodeEach[T any](res *http.Response, fn func(T) error) error {
+	defer closeResponse(res)
+	dec := json.NewDecoder(res.Body)
+	tok, err := dec.Token()
+	if err != nil || tok == nil {
+		return err // null is an empty array
+	}
+	if tok != json.Delim('[') {
+		return fmt.Errorf("unexpected response, expected JSON array: %v", tok)
+	}
+	for dec.More() {
+		var v T
+		if err := dec.Decode(&v); err != nil {
+			return err
+		}
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+	_, err = dec.Token()
+	return err
+}
+
+// closeResponse drains and closes body of res so the connection can be reused
+func closeResponse(res *http.Response) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, maxErrorBodySize))
+	if err := res.Body.Close(); err != nil {
+		fmt.Println("failed to close response", err)
+	}
+}
+
+// An APIError represents an error response from SORACOM API. Use errors.As to
+// get the details, or errors.Is with an APIError as the target to match by
+// status code and error code.
+type APIError struct {
+	StatusCode int      // HTTP status code
+	Status     string   // HTTP status, e.g. "404 Not Found"
+	Method     string   // HTTP method of the request
+	URL        *url.URL // URL of the request
+	Code       string   // SORACOM error code, e.g. "AUTH0001", if any
+	Message    string   // SORACOM error message, if any
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s: %s %s", e.Status, e.Method, e.URL)
+	if e.Message != "" {
+		msg = fmt.Sprintf("%s: %s", msg, e.Message)
+	}
+	if e.Code != "" {
+		msg = fmt.Sprintf("%s (%s)", msg, e.Code)
+	}
+	return msg
+}
+
+// Is reports whether target is an *APIError whose non-zero StatusCode and
+// Code match e, e.g. errors.Is(err, &APIError{StatusCode: 404})
+func (e *APIError) Is(target error) bool {
+	t, ok := target.(*APIError)
+	if !ok {
+		return false
+	}
+	return (t.StatusCode == 0 || t.StatusCode == e.StatusCode) && (t.Code == "" || t.Code == e.Code)
+}
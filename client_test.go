@@ -0,0 +1,575 @@
+package nssh
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/0x6b/nssh/models"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDialUnreachable(t *testing.T) {
+	c := newCoverageClient(t, "japan", &MockData{}, &MockData{})
+	opts := ConnectOptions{Password: "secret", Timeout: 5 * time.Second}
+
+	// the port mapping has expired, and nothing listens on the port
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused := l.Addr().String()
+	_ = l.Close()
+	if _, err := c.Dial("pi", "", &models.PortMapping{Endpoint: refused}, opts); !errors.Is(err, ErrUnreachable) {
+		t.Errorf("Dial() to closed port = %v, want ErrUnreachable", err)
+	}
+
+	// the connection is closed before SSH handshake
+	l, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+	if _, err := c.Dial("pi", "", &models.PortMapping{Endpoint: l.Addr().String()}, opts); !errors.Is(err, ErrUnreachable) {
+		t.Errorf("Dial() closed by server = %v, want ErrUnreachable", err)
+	}
+}
+
+// newSubscribersServer returns the client for httptest TLS server which serves
+// subscribers named "gateway" in two pages, and the port mapping of the first
+// one
+func newSubscribersServer(t *testing.T, options ...Option) *SoracomClient {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/subscribers", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("tag_name") != "name" || q.Get("tag_value") != "gateway" || q.Get("tag_value_match_mode") != "exact" {
+			_, _ = w.Write([]byte(`[]`))
+			return
+		}
+		if r.URL.Query().Get("last_evaluated_key") == "" {
+			w.Header().Set("X-Soracom-Next-Key", "440100000000001")
+			_, _ = w.Write([]byte(`[{"imsi": "440100000000001", "simId": "8981100000000000001", "tags": {"name": "gateway"}}]`))
+			return
+		}
+		_, _ = w.Write([]byte(`[{"imsi": "440100000000002", "simId": "8981100000000000002", "tags": {"name": "gateway"}}]`))
+	})
+	mux.HandleFunc("GET /v1/subscribers/{imsi}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("imsi") != "440100000000001" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"code": "SEM0004", "message": "No such subscriber"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"imsi": "440100000000001", "simId": "8981100000000000001", "subscription": "plan01s", "type": "s1.fast", "tags": {"name": "gateway"}}`))
+	})
+	mux.HandleFunc("GET /v1/port_mappings/subscribers/{imsi}", func(w http.ResponseWriter, r *http.Request) {
+		pms := []models.PortMapping{}
+		if r.PathValue("imsi") == "440100000000001" {
+			var pm models.PortMapping
+			pm.Endpoint = "192.0.2.10:10000"
+			pm.Destination.ID = "8981100000000000001"
+			pms = append(pms, pm)
+		}
+		_ = json.NewEncoder(w).Encode(pms)
+	})
+	server := httptest.NewTLSServer(mux)
+	t.Cleanup(server.Close)
+
+	t.Setenv("SORACOM_API_KEY", "api-key")
+	t.Setenv("SORACOM_TOKEN", "token")
+	c, err := NewSoracomClient("japan", "nssh", append([]Option{WithEndpoint(server.URL), WithHTTPClient(server.Client())}, options...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestGetSubscriber(t *testing.T) {
+	c := newSubscribersServer(t)
+
+	sub, err := c.GetSubscriber("440100000000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.SIMID != "8981100000000000001" || sub.String() != "gateway (440100000000001 / plan01s / s1.fast)" {
+		t.Errorf("GetSubscriber() = %+v", sub)
+	}
+	if _, err := c.GetSubscriber("440100000000009"); !errors.Is(err, ErrSIMNotFound) {
+		t.Errorf("GetSubscriber() of unknown IMSI = %v, want ErrSIMNotFound", err)
+	}
+}
+
+func TestFindSubscribersByName(t *testing.T) {
+	c := newSubscribersServer(t)
+
+	subs, err := c.FindSubscribersByName("gateway")
+	if err != nil || len(subs) != 2 {
+		t.Fatalf("FindSubscribersByName() = %v, %v, want both pages", subs, err)
+	}
+	if subs, err := c.FindSubscribersByName("gate"); err != nil || len(subs) != 0 {
+		t.Errorf("FindSubscribersByName() of partial name = %v, %v, want none", subs, err)
+	}
+
+	pms, err := c.FindPortMappingsForSubscriber(subs[0])
+	if err != nil || len(pms) != 1 || pms[0].Endpoint != "192.0.2.10:10000" {
+		t.Errorf("FindPortMappingsForSubscriber() = %v, %v", pms, err)
+	}
+	if pms, err := c.FindPortMappingsForSubscriber(subs[1]); err != nil || len(pms) != 0 {
+		t.Errorf("FindPortMappingsForSubscriber() = %v, %v, want none", pms, err)
+	}
+}
+
+func TestFindSubscribersByNameWithLimit(t *testing.T) {
+	c := newSubscribersServer(t, WithSIMLimit(1))
+
+	subs, err := c.FindSubscribersByName("gateway")
+	if err != nil || len(subs) != 1 || subs[0].IMSI != "440100000000001" {
+		t.Errorf("FindSubscribersByName() = %v, %v, want the first page only", subs, err)
+	}
+}
+
+// roundTripperFunc is http.RoundTripper of a function
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// textResponse returns response of status with body
+func textResponse(req *http.Request, status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}
+}
+
+// jsonResponse returns 200 OK response of v encoded in JSON
+func jsonResponse(req *http.Request, v any) (*http.Response, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(b)),
+		Request:    req,
+	}, nil
+}
+
+// pagedSIMs returns a transport which serves n SIMs named "gateway", two SIMs
+// per page, and counts the requests
+func pagedSIMs(n int, requests *int) roundTripperFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		*requests++
+		start, _ := strconv.Atoi(req.URL.Query().Get("last_evaluated_key"))
+		sims := []models.SIM{}
+		if req.URL.Query().Get("name") == "gateway" {
+			for i := start; i < min(start+2, n); i++ {
+				sim := models.SIM{ID: strconv.Itoa(i)}
+				sim.Tags.Name = "gateway"
+				sims = append(sims, sim)
+			}
+		}
+		res, err := jsonResponse(req, sims)
+		if err != nil {
+			return nil, err
+		}
+		if len(sims) > 0 && start+2 < n {
+			res.Header.Set("X-Soracom-Next-Key", strconv.Itoa(start+2))
+		}
+		return res, nil
+	}
+}
+
+func TestFindSIMsByNamePaginates(t *testing.T) {
+	t.Setenv("SORACOM_API_KEY", "api-key")
+	t.Setenv("SORACOM_TOKEN", "token")
+
+	tests := []struct {
+		name     string
+		limit    int
+		want     int
+		requests int
+	}{
+		{name: "unlimited", want: 6, requests: 3},
+		{name: "limit in a page", limit: 3, want: 3, requests: 2},
+		{name: "limit at the end of a page", limit: 4, want: 4, requests: 2},
+		{name: "limit of all", limit: 6, want: 6, requests: 3},
+		{name: "limit over all", limit: 10, want: 6, requests: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int
+			c, err := NewSoracomClient("jp", "", WithHTTPClient(&http.Client{Transport: pagedSIMs(6, &requests)}), WithSIMLimit(tt.limit))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sims, err := c.FindSIMsByName("gateway")
+			if err != nil || len(sims) != tt.want {
+				t.Fatalf("FindSIMsByName() = %d SIMs, %v, want %d", len(sims), err, tt.want)
+			}
+			if requests != tt.requests {
+				t.Errorf("requests = %d, want %d", requests, tt.requests)
+			}
+		})
+	}
+}
+
+func TestFindAvailablePortMappingsForSIM(t *testing.T) {
+	t.Setenv("SORACOM_API_KEY", "api-key")
+	t.Setenv("SORACOM_TOKEN", "token")
+
+	var pms []models.PortMapping
+	if err := json.Unmarshal([]byte(`[
+		{"endpoint": "192.0.2.10:1", "destination": {"simId": "8981100000000000001", "port": 22}, "source": {"ipRanges": ["192.0.2.1/32"]}},
+		{"endpoint": "192.0.2.10:2", "destination": {"simId": "8981100000000000001", "port": 22}, "source": {"ipRanges": ["198.51.100.0/24"]}},
+		{"endpoint": "192.0.2.10:3", "destination": {"simId": "8981100000000000001", "port": 22}, "source": {"ipRanges": ["invalid", "192.0.2.0/24"]}},
+		{"endpoint": "192.0.2.10:4", "destination": {"simId": "8981100000000000001", "port": 80}, "source": {"ipRanges": ["192.0.2.1/32"]}},
+		{"endpoint": "192.0.2.10:5", "destination": {"simId": "8981100000000000001", "port": 22}, "source": {"ipRanges": ["192.0.2.1/32"]}, "tlsRequired": true}
+	]`), &pms); err != nil {
+		t.Fatal(err)
+	}
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host == "checkip.example.com" {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader("192.0.2.1\n")),
+				Request:    req,
+			}, nil
+		}
+		return jsonResponse(req, pms)
+	})
+	c, err := NewSoracomClient("jp", "",
+		WithHTTPClient(&http.Client{Transport: transport}),
+		WithCheckIPEndpoint("https://checkip.example.com/"),
+		WithEmitter(NewTextEmitter(io.Discard, "en")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	available, err := c.FindAvailablePortMappingsForSIM(models.SIM{ID: "8981100000000000001"}, 22, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var endpoints []string
+	for _, pm := range available {
+		endpoints = append(endpoints, pm.Endpoint)
+	}
+	if strings.Join(endpoints, ",") != "192.0.2.10:1,192.0.2.10:3" {
+		t.Errorf("FindAvailablePortMappingsForSIM() = %v, want the ones for the port and permitting 192.0.2.1", endpoints)
+	}
+}
+
+func TestFindOnlineSIMsByName(t *testing.T) {
+	t.Setenv("SORACOM_API_KEY", "api-key")
+	t.Setenv("SORACOM_TOKEN", "token")
+
+	tests := []struct {
+		name    string
+		status  int // status of the combined query, if it fails
+		queries []string
+		wantErr bool
+	}{
+		{name: "server side", queries: []string{"limit=100&name=gateway&search_type=AND&session_status=ONLINE"}},
+		{name: "client side fallback", status: http.StatusBadRequest, queries: []string{
+			"limit=100&name=gateway&search_type=AND&session_status=ONLINE",
+			"limit=100&name=gateway",
+		}},
+		{name: "no fallback for other errors", status: http.StatusInternalServerError, queries: []string{
+			"limit=100&name=gateway&search_type=AND&session_status=ONLINE",
+		}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var queries []string
+			transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				q := req.URL.Query()
+				queries = append(queries, q.Encode())
+				online := q.Get("session_status") == "ONLINE"
+				if online && tt.status != 0 {
+					return &http.Response{
+						StatusCode: tt.status,
+						Status:     http.StatusText(tt.status),
+						Body:       io.NopCloser(strings.NewReader(`{"code": "SEM0001", "message": "failed"}`)),
+						Request:    req,
+					}, nil
+				}
+				var sims []models.SIM
+				if err := json.Unmarshal([]byte(`[
+					{"simId": "8981100000000000001", "tags": {"name": "gateway"}, "sessionStatus": {"online": true}},
+					{"simId": "8981100000000000002", "tags": {"name": "gateway"}, "sessionStatus": {"online": false}}
+				]`), &sims); err != nil {
+					return nil, err
+				}
+				if online {
+					sims = sims[:1]
+				}
+				return jsonResponse(req, sims)
+			})
+			c, err := NewSoracomClient("jp", "", WithHTTPClient(&http.Client{Transport: transport}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sims, err := c.FindOnlineSIMsByName("gateway")
+			if tt.wantErr {
+				if !errors.Is(err, &APIError{StatusCode: tt.status}) {
+					t.Errorf("FindOnlineSIMsByName() = %v, %v, want error of %d", sims, err, tt.status)
+				}
+			} else if err != nil || len(sims) != 1 || sims[0].ID != "8981100000000000001" {
+				t.Errorf("FindOnlineSIMsByName() = %v, %v, want the online SIM only", sims, err)
+			}
+			if strings.Join(queries, " ") != strings.Join(tt.queries, " ") {
+				t.Errorf("queries = %q, want %q", queries, tt.queries)
+			}
+		})
+	}
+}
+
+func TestWithTransport(t *testing.T) {
+	var paths []string
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		paths = append(paths, req.URL.Host+req.URL.Path)
+		return jsonResponse(req, []models.SIM{})
+	})
+	httpClient := &http.Client{Timeout: time.Minute}
+
+	t.Setenv("SORACOM_API_KEY", "api-key")
+	t.Setenv("SORACOM_TOKEN", "token")
+	c, err := NewSoracomClient("jp", "", WithHTTPClient(httpClient), WithTransport(transport), WithEndpoint("https://api.example.com/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.FindOnlineSIMs(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(paths) != 1 || paths[0] != "api.example.com/v1/query/sims" {
+		t.Errorf("requests = %v, want query/sims to the endpoint", paths)
+	}
+	if c.Client.Timeout != time.Minute {
+		t.Errorf("timeout = %v, want the one of WithHTTPClient", c.Client.Timeout)
+	}
+	if httpClient.Transport != nil || http.DefaultClient.Transport != nil {
+		t.Error("WithTransport modified http.Client given or http.DefaultClient")
+	}
+}
+
+func TestFindOnlineSIMsFollowsNextKey(t *testing.T) {
+	t.Setenv("SORACOM_API_KEY", "api-key")
+	t.Setenv("SORACOM_TOKEN", "token")
+
+	var keys []string
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		key := req.URL.Query().Get("last_evaluated_key")
+		keys = append(keys, key)
+		if key == "" {
+			res, err := jsonResponse(req, []models.SIM{{ID: "8981100000000000001"}})
+			res.Header.Set("X-Soracom-Next-Key", "8981100000000000001")
+			return res, err
+		}
+		return jsonResponse(req, []models.SIM{{ID: "8981100000000000002"}})
+	})
+	c, err := NewSoracomClient("jp", "", WithTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sims, err := c.FindOnlineSIMs()
+	if err != nil || len(sims) != 2 {
+		t.Fatalf("FindOnlineSIMs() = %v, %v, want SIMs of both pages", sims, err)
+	}
+	if len(keys) != 2 || keys[1] != "8981100000000000001" {
+		t.Errorf("last_evaluated_key = %q, want the next key of the first page", keys)
+	}
+}
+
+func TestDoRequestErrors(t *testing.T) {
+	t.Setenv("SORACOM_API_KEY", "api-key")
+	t.Setenv("SORACOM_TOKEN", "token")
+
+	tests := []struct {
+		name      string
+		transport roundTripperFunc
+		check     func(t *testing.T, err error)
+	}{
+		{
+			name: "error response",
+			transport: func(req *http.Request) (*http.Response, error) {
+				return textResponse(req, http.StatusForbidden, `{"code": "AUM0001", "message": "forbidden"}`), nil
+			},
+			check: func(t *testing.T, err error) {
+				var apiError *APIError
+				if !errors.As(err, &apiError) || apiError.StatusCode != http.StatusForbidden || apiError.Code != "AUM0001" || apiError.Message != "forbidden" {
+					t.Errorf("err = %#v, want APIError with the code and the message", err)
+				}
+				if !errors.Is(err, &APIError{StatusCode: http.StatusForbidden}) || errors.Is(err, &APIError{StatusCode: http.StatusNotFound}) {
+					t.Errorf("errors.Is() does not match status code of %v", err)
+				}
+				if !strings.Contains(err.Error(), "forbidden (AUM0001)") {
+					t.Errorf("err = %q, want the message and the code", err)
+				}
+			},
+		},
+		{
+			name: "error response without JSON",
+			transport: func(req *http.Request) (*http.Response, error) {
+				return textResponse(req, http.StatusBadGateway, "<html>Bad Gateway</html>"), nil
+			},
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, &APIError{StatusCode: http.StatusBadGateway}) {
+					t.Errorf("err = %v, want APIError of 502", err)
+				}
+			},
+		},
+		{
+			name: "transport error",
+			transport: func(req *http.Request) (*http.Response, error) {
+				return nil, errors.New("connection refused")
+			},
+			check: func(t *testing.T, err error) {
+				var apiError *APIError
+				if err == nil || errors.As(err, &apiError) || !strings.Contains(err.Error(), "connection refused") {
+					t.Errorf("err = %v, want the error of the transport", err)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewSoracomClient("jp", "", WithTransport(tt.transport))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = c.GetSIM("8981100000000000001")
+			tt.check(t, err)
+		})
+	}
+}
+
+func TestSIMNotFound(t *testing.T) {
+	var queries []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		q := r.URL.Query()
+		if q.Get("sim_id") == "8981100000000000001" || q.Get("imsi") != "" {
+			// the query API matches IMSI partially
+			_, _ = w.Write([]byte(`[{"simId": "8981100000000000001", "profiles": {"8981100000000000001": {"subscribers": {"440100000000001": {"imsi": "440100000000001"}}}}}]`))
+			return
+		}
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	t.Setenv("SORACOM_API_KEY", "api-key")
+	t.Setenv("SORACOM_TOKEN", "token")
+	c, err := NewSoracomClient("jp", "", WithEndpoint(server.URL), WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sim, err := c.GetSIM("8981100000000000001"); err != nil || sim.ID != "8981100000000000001" {
+		t.Errorf("GetSIM() = %v, %v", sim, err)
+	}
+	if sim, err := c.FindSIMByIMSI("440100000000001"); err != nil || sim.ID != "8981100000000000001" {
+		t.Errorf("FindSIMByIMSI() = %v, %v", sim, err)
+	}
+	if !strings.Contains(strings.Join(queries, " "), "imsi=440100000000001") {
+		t.Errorf("queries = %q, want the one by imsi", queries)
+	}
+
+	tests := []struct {
+		name   string
+		lookup func() (*models.SIM, error)
+		want   error
+	}{
+		{name: "GetSIM", lookup: func() (*models.SIM, error) { return c.GetSIM("8981100000000000009") }, want: ErrSIMNotFound},
+		{name: "FindSIMByIMSI of partial IMSI", lookup: func() (*models.SIM, error) { return c.FindSIMByIMSI("44010000000000") }, want: ErrSIMNotFound},
+		{name: "GetOnlineSIM", lookup: func() (*models.SIM, error) { return c.GetOnlineSIM("8981100000000000009") }, want: ErrSIMNotFound},
+		{name: "FindOnlineSIMByIMSI", lookup: func() (*models.SIM, error) { return c.FindOnlineSIMByIMSI("440100000000009") }, want: ErrSIMNotFound},
+		{name: "GetOnlineSIM of offline SIM", lookup: func() (*models.SIM, error) { return c.GetOnlineSIM("8981100000000000001") }, want: ErrSIMOffline},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if sim, err := tt.lookup(); !errors.Is(err, tt.want) {
+				t.Errorf("%s() = %v, %v, want %v", tt.name, sim, err, tt.want)
+			}
+		})
+	}
+}
+
+// napterTransport returns a transport which serves port mappings created by
+// the client, and tells 192.0.2.1 as current IP address
+func napterTransport() roundTripperFunc {
+	var (
+		mu  sync.Mutex
+		pms []models.PortMapping
+	)
+	return func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case req.URL.Host == "checkip.example.com":
+			return textResponse(req, http.StatusOK, "192.0.2.1\n"), nil
+		case req.Method == "POST" && req.URL.Path == "/v1/port_mappings":
+			var pm models.PortMapping
+			if err := json.NewDecoder(req.Body).Decode(&pm); err != nil {
+				return nil, err
+			}
+			pm.Endpoint = fmt.Sprintf("192.0.2.10:%d", len(pms)+1)
+			pms = append(pms, pm)
+			return jsonResponse(req, pm)
+		case req.Method == "GET" && strings.HasPrefix(req.URL.Path, "/v1/port_mappings/sims/"):
+			return jsonResponse(req, pms)
+		}
+		return textResponse(req, http.StatusNotFound, `{"message": "not found"}`), nil
+	}
+}
+
+func TestEnsurePortMappingForNonStandardPort(t *testing.T) {
+	t.Setenv("SORACOM_API_KEY", "api-key")
+	t.Setenv("SORACOM_TOKEN", "token")
+	c, err := NewSoracomClient("jp", "",
+		WithTransport(napterTransport()),
+		WithCheckIPEndpoint("https://checkip.example.com/"),
+		WithEmitter(NewTextEmitter(io.Discard, "en")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim := models.SIM{ID: "8981100000000000001"}
+
+	pm, created, err := c.EnsurePortMapping(sim, 2222, 60, nil, false)
+	if err != nil || !created || pm.Destination.ID != sim.ID || pm.Destination.Port != 2222 {
+		t.Fatalf("EnsurePortMapping() = %+v, %v, %v, want new one to port 2222", pm, created, err)
+	}
+	if pm, created, err := c.EnsurePortMapping(sim, 2222, 60, nil, false); err != nil || created || pm.Destination.Port != 2222 {
+		t.Errorf("EnsurePortMapping() = %+v, %v, %v, want the one to port 2222 reused", pm, created, err)
+	}
+	if pm, created, err := c.EnsurePortMapping(sim, 22, 60, nil, false); err != nil || !created || pm.Destination.Port != 22 {
+		t.Errorf("EnsurePortMapping() = %+v, %v, %v, want new one to port 22", pm, created, err)
+	}
+	if available, err := c.FindAvailablePortMappingsForSIM(sim, 2222, false); err != nil || len(available) != 1 {
+		t.Errorf("FindAvailablePortMappingsForSIM() = %v, %v, want only the one to port 2222", available, err)
+	}
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+var format string
+
+func authCmd() *cobra.Command {
+	authCmd := &cobra.Command{
+		Use:   "auth",
+		Short: "Manage authentication for SORACOM API.",
+	}
+
+	tokenCmd := &cobra.Command{
+		Use:   "token",
+		Short: "Authenticate and print API key and token, e.g. for SORACOM CLI in CI.",
+		Long:  "Authenticate with the profile and print API key and token, without doing anything else. Use --format export to set them to environment variables with eval $(nssh auth token --format export).",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			apiKey, token := client.Credentials()
+			switch format {
+			case "json":
+				err := json.NewEncoder(os.Stdout).Encode(struct {
+					APIKey string `json:"apiKey"`
+					Token  string `json:"token"`
+				}{
+					APIKey: apiKey,
+					Token:  token,
+				})
+				if err != nil {
+					exitWithError(err)
+				}
+			case "export":
+				fmt.Printf("export SORACOM_API_KEY=%s\n", apiKey)
+				fmt.Printf("export SORACOM_TOKEN=%s\n", token)
+			default:
+				exitWithError(usageErrorf("invalid format: %s", format))
+			}
+		},
+	}
+	tokenCmd.Flags().StringVarP(&format, "format", "f", "json", "Specify output format, \"json\" or \"export\"")
+
+	authCmd.AddCommand(tokenCmd)
+	return authCmd
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/0x6b/nssh"
+	"github.com/0x6b/nssh/models"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+var namesFile string
+
+func batchCmd() *cobra.Command {
+	batchCmd := &cobra.Command{
+		Use:   "batch --names <file> -- <command>",
+		Short: "Run command on the subscribers listed in a file.",
+		Long:  "Read subscriber names from the file, one per line, and run the command on each of them concurrently up to --concurrency. Empty lines and lines starting with # are ignored, and imsi: or sim: prefix can be used as connect. Failures on some subscribers do not stop the others. A table of the results and the counts are printed at the end, and nssh exits with non-zero status if failed on any subscriber.",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			defer tracker.watchSignals()()
+
+			if err := nssh.ValidatePortMapping(port, duration); err != nil {
+				exitWithError(usageErrorf("%w", err))
+			}
+			if err := checkUnattendedAuth("batch"); err != nil {
+				exitWithError(usageErrorf("%w", err))
+			}
+			if parallel < 1 {
+				exitWithError(usageErrorf("--concurrency must be 1 or more"))
+			}
+			names, err := readNames(namesFile)
+			if err != nil {
+				fmt.Printf("nssh: failed to read subscriber names: %v\n", err)
+				os.Exit(1)
+			}
+			execCommand = strings.Join(args, " ")
+
+			// resolve all names first, so that the command runs on the resolved
+			// ones even if some of them fail
+			errs := make([]error, len(names))
+			var sims []models.SIM
+			var indexes []int
+			for i, name := range names {
+				sim, err := resolveSIM(name)
+				if err != nil {
+					errs[i] = err
+					continue
+				}
+				sims = append(sims, *sim)
+				indexes = append(indexes, i)
+			}
+			for i, err := range runOnSIMs(sims) {
+				errs[indexes[i]] = err
+			}
+
+			if !printBatchResults(names, errs) {
+				os.Exit(1)
+			}
+		},
+	}
+
+	batchCmd.Flags().StringVar(&namesFile, "names", "", "Specify a path to file of subscriber names, one per line")
+	_ = batchCmd.MarkFlagRequired("names")
+	batchCmd.Flags().IntVar(&parallel, "concurrency", 4, "Specify maximum number of subscribers to run the command on concurrently")
+	batchCmd.Flags().StringVarP(&login, "login", "u", defaultLogin(), "Specify login user name. SORACOM_DEFAULT_USER environment variable is the default if set")
+	addConnectFlags(batchCmd)
+	return batchCmd
+}
+
+// readNames reads subscriber names from path, ignoring empty lines and
+// comments
+func readNames(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var names []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		names = append(names, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, errors.New("no subscriber names in " + path)
+	}
+	return names, nil
+}
+
+// resolveSIM finds the online SIM specified by [name:|imsi:|sim:]<value>
+// without asking, and returns an error if there are multiple SIMs with the name
+func resolveSIM(target string) (*models.SIM, error) {
+	selector, value := parseSelector(target)
+	switch selector {
+	case selectByIMSI:
+		return client.FindOnlineSIMByIMSI(value)
+	case selectBySIMID:
+		return client.GetOnlineSIM(value)
+	}
+
+	sims, err := client.FindOnlineSIMsByName(value)
+	switch {
+	case err != nil:
+		return nil, err
+	case len(sims) == 0:
+		return nil, fmt.Errorf("no online subscriber named \"%s\"", value)
+	case len(sims) > 1 && selectFirst:
+		return firstSIM(sims), nil
+	case len(sims) > 1:
+		return nil, fmt.Errorf("multiple subscribers named \"%s\", specify one of them with sim: prefix, or --select-first", value)
+	}
+	return &sims[0], nil
+}
+
+// printBatchResults prints the result of each subscriber and the counts, and
+// returns true if succeeded on all subscribers
+func printBatchResults(names []string, errs []error) bool {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "\nSUBSCRIBER\tRESULT")
+	failed := 0
+	for i, name := range names {
+		result := "ok"
+		var exitError *ssh.ExitError
+		switch {
+		case errs[i] == nil:
+		case errors.As(errs[i], &exitError):
+			result = fmt.Sprintf("exit status %d", exitError.ExitStatus())
+		default:
+			result, _, _ = strings.Cut(errs[i].Error(), "\n")
+		}
+		if errs[i] != nil {
+			failed++
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\n", name, result)
+	}
+	_ = w.Flush()
+
+	fmt.Printf("\n%d succeeded, %d failed, %d total\n", len(names)-failed, failed, len(names))
+	return failed == 0
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"github.com/0x6b/nssh"
+	"github.com/0x6b/nssh/models"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// exit code on SIGINT or SIGTERM, following the shell convention
+const exitInterrupted = 130
+
+// how long to wait for the port mappings being created on SIGINT or SIGTERM
+const creationWait = 10 * time.Second
+
+// A portMappingTracker tracks port mappings created by nssh, to delete them
+// even if nssh is interrupted before the session ends
+type portMappingTracker struct {
+	mu           sync.Mutex
+	portMappings []*models.PortMapping
+	creating     sync.WaitGroup
+}
+
+var tracker portMappingTracker
+
+// watchSignals deletes the tracked port mappings including the ones being
+// created, then exits with exitInterrupted on SIGINT or SIGTERM. Returned
+// function stops watching. SIGWINCH handled in Connect is not affected.
+func (t *portMappingTracker) watchSignals() func() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ch:
+			_ = nssh.RestoreTerminal()
+			t.waitCreating()
+			t.releaseAll()
+			os.Exit(exitInterrupted)
+		case <-done:
+		}
+	}()
+
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
+
+// create finds or creates port mapping with fn, and tracks it if created
+func (t *portMappingTracker) create(fn func() (*models.PortMapping, bool, error)) (*models.PortMapping, bool, error) {
+	t.creating.Add(1)
+	defer t.creating.Done()
+
+	portMapping, created, err := fn()
+	if err != nil || !created {
+		return portMapping, created, err
+	}
+
+	t.mu.Lock()
+	t.portMappings = append(t.portMappings, portMapping)
+	t.mu.Unlock()
+	return portMapping, true, nil
+}
+
+// release deletes the port mapping if it is still tracked, and stops tracking
+func (t *portMappingTracker) release(portMapping *models.PortMapping) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i, pm := range t.portMappings {
+		if pm == portMapping {
+			t.portMappings = append(t.portMappings[:i], t.portMappings[i+1:]...)
+			deletePortMapping(pm)
+			return
+		}
+	}
+}
+
+// releaseAll deletes all the tracked port mappings
+func (t *portMappingTracker) releaseAll() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, pm := range t.portMappings {
+		deletePortMapping(pm)
+	}
+	t.portMappings = nil
+}
+
+// waitCreating waits for the port mappings being created, up to creationWait
+func (t *portMappingTracker) waitCreating() {
+	done := make(chan struct{})
+	go func() {
+		t.creating.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(creationWait):
+	}
+}
+
+func deletePortMapping(portMapping *models.PortMapping) {
+	if err := client.DeletePortMapping(portMapping); err != nil {
+		emitter.Emit("port_mapping_delete_failed", map[string]any{"endpoint": portMapping.Endpoint, "error": err}, "→ failed to delete port mapping %s: %v", portMapping.Endpoint, err)
+		return
+	}
+	emitter.Emit("port_mapping_deleted", map[string]any{"endpoint": portMapping.Endpoint}, "→ deleted port mapping %s", portMapping.Endpoint)
+}
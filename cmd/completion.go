@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"os"
+)
+
+func completionCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "completion bash|zsh|fish",
+		Short: "Generate shell completion script.",
+		Long: `Generate completion script for bash, zsh or fish to stdout. No credentials are required.
+
+To load completions for every new session:
+
+  bash: nssh completion bash > /etc/bash_completion.d/nssh
+        (or $(brew --prefix)/etc/bash_completion.d/nssh on macOS)
+  zsh:  nssh completion zsh > "${fpath[1]}/_nssh"
+  fish: nssh completion fish > ~/.config/fish/completions/nssh.fish`,
+		ValidArgs: []string{"bash", "zsh", "fish"},
+		Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+		Run: func(cmd *cobra.Command, args []string) {
+			var err error
+			switch args[0] {
+			case "bash":
+				err = RootCmd.GenBashCompletionV2(os.Stdout, true)
+			case "zsh":
+				err = RootCmd.GenZshCompletion(os.Stdout)
+			case "fish":
+				err = RootCmd.GenFishCompletion(os.Stdout, true)
+			}
+			if err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+}
@@ -1,87 +1,703 @@
 package cmd
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/0x6b/nssh"
 	"github.com/0x6b/nssh/models"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
+	"net"
 	"os"
+	"slices"
 	"strings"
+	"time"
 )
 
 func connectCmd() *cobra.Command {
 	connectCmd := &cobra.Command{
-		Use:     "connect [<user>@]<subscriber name>",
+		Use:     "connect [<user>@][name:|imsi:|sim:]<subscriber name>",
 		Aliases: []string{"c"},
 		Short:   "Connect to specified subscriber via SSH.",
-		Long:    "Create port mappings for specified subscriber and connect via SSH. If <user>@ is not specified, \"pi\" will be used as default. Quote with \" if name contains spaces or special characters.",
-		Args:    cobra.RangeArgs(1, 1),
+		Long:    "Create port mappings for specified subscriber and connect via SSH. If <user>@ is not specified, SORACOM_DEFAULT_USER environment variable, or \"pi\" will be used as default. Quote with \" if name contains spaces or special characters. Prefix imsi: or sim: to specify the subscriber by IMSI or SIM ID instead of name, or name: if the name itself starts with them. The first @ separates the user, so specify a name containing @ as @<name>, name:<name> or <user>@<name>. With --sim-id, the subscriber name should be omitted, i.e. [<user>@] only. Without the subscriber name, ask whether to reconnect to the subscriber connected most recently, or reconnect without asking with --last.",
+		Args:    cobra.RangeArgs(0, 1),
 		Run: func(cmd *cobra.Command, args []string) {
-			login, name := parseArg(args[0])
+			defer tracker.watchSignals()()
 
-			fmt.Printf("nssh: search subscribers named \"%s\"\n", name)
-			onlineSIMs, err := client.FindOnlineSIMsByName(name)
-			if err != nil || len(onlineSIMs) == 0 {
-				fmt.Printf("nssh: → failed to find online subscribers named \"%s\"\n", name)
-				os.Exit(1)
+			if err := nssh.ValidatePortMapping(port, duration); err != nil {
+				exitWithError(usageErrorf("%w", err))
 			}
-
-			if len(onlineSIMs) > 1 {
-				fmt.Printf("nssh: → cannot create port mapping as there are multiple subscribers named \"%s\"\n", name)
-				for _, s := range onlineSIMs {
-					fmt.Printf("nssh: - %s\n", s)
+			if reconnect && jump != "" {
+				exitWithError(usageErrorf("cannot specify both --reconnect and --jump"))
+			}
+			if evalOutput {
+				if printEndpoint != "" {
+					exitWithError(usageErrorf("cannot specify both --eval and --print-endpoint"))
 				}
-				os.Exit(1)
+				printEndpoint = "eval"
 			}
-
-			sim := onlineSIMs[0]
-			fmt.Printf("nssh: → found SIM %s\n", sim)
-
-			fmt.Printf("nssh: search existing port mappings for %s:%d\n", sim.ID, port)
-			var portMapping *models.PortMapping
-
-			available, err := client.FindAvailablePortMappingsForSIM(sim, port)
-			if err != nil || len(available) == 0 {
-				fmt.Printf("nssh: → no existing port mapping for %s:%d, creating\n", sim.ID, port)
-				portMapping, err = client.CreatePortMappingForSIM(sim, port, duration)
+			switch printEndpoint {
+			case "":
+			case "text", "json", "eval":
+				if jump != "" || dryRun {
+					exitWithError(usageErrorf("cannot specify --jump or --dry-run with --print-endpoint or --eval"))
+				}
+				// the port mapping is used by another tool after nssh exits
+				cleanup = false
+			default:
+				exitWithError(usageErrorf("invalid --print-endpoint %s, specify text or json", printEndpoint))
+			}
+			if sessionLogInput && sessionLog == "" {
+				exitWithError(usageErrorf("--log-session-input requires --log-session"))
+			}
+			if sessionLog != "" {
+				f, err := os.OpenFile(sessionLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
 				if err != nil {
-					fmt.Println(err)
+					fmt.Printf("nssh: failed to open session log: %v\n", err)
 					os.Exit(1)
 				}
-			} else {
-				portMapping = &available[0]
-				fmt.Printf("nssh: → found available port mapping:\n%s\n", portMapping)
+				defer f.Close()
+				sessionLogWriter = nssh.NewSessionLog(f)
+			}
+			if err := parseLocalForwards(); err != nil {
+				exitWithError(usageErrorf("%w", err))
+			}
+			login, selector, value := defaultLogin(), selectByName, ""
+			if len(args) > 0 {
+				login, selector, value = parseArg(args[0])
+			}
+			loginSpecified := false
+			if len(args) > 0 {
+				user, _ := splitLogin(args[0])
+				loginSpecified = user != ""
+			}
+			if simID != "" {
+				if value != "" || last {
+					exitWithError(usageErrorf("cannot specify more than one of subscriber name, --sim-id and --last"))
+				}
+				selector, value = selectBySIMID, simID
+			}
+			if value == "" {
+				lc, err := lastConnection(!last)
+				if err != nil {
+					exitWithError(err)
+				}
+				if lc == nil && last {
+					fmt.Println("nssh: no connection to reconnect, specify subscriber name or --sim-id")
+					os.Exit(1)
+				}
+				if lc == nil {
+					exitWithError(usageErrorf("specify subscriber name, --sim-id or --last"))
+				}
+				selector, value = selectBySIMID, lc.SIMID
+				if !loginSpecified {
+					login, loginSpecified = lc.Login, true
+				}
+				if !cmd.Flags().Changed("port") {
+					port = lc.Port
+				}
+			} else if last {
+				exitWithError(usageErrorf("cannot specify more than one of subscriber name, --sim-id and --last"))
 			}
 
-			fmt.Printf("nssh: connect to %s@%s:%d using the port mapping\n", login, sim.ID, port)
-			fmt.Println(strings.Repeat("-", 40))
-			err = client.Connect(login, identity, portMapping)
+			start := time.Now()
+			sim, err := findOnlineSIM(selector, value)
 			if err != nil {
-				fmt.Println(err)
-				os.Exit(1)
+				exitWithError(err)
+			}
+			if sim == nil {
+				return
+			}
+			timings.Record("SIM lookup", start)
+
+			login = applySSHConfig(cmd.Flags(), *sim, login, loginSpecified)
+
+			err = connectToSIM(login, *sim)
+			reportTimings()
+			if sessionLogWriter != nil && sessionLogWriter.Err() != nil {
+				fmt.Printf("nssh: failed to write session log: %v\n", sessionLogWriter.Err())
+			}
+			if err != nil {
+				exitWithError(err)
 			}
 		},
 	}
 
-	connectCmd.Flags().StringVarP(&identity, "identity", "i", "", "Specify a path to file from which the identity for public key authentication is read")
-	connectCmd.Flags().IntVarP(&port, "port", "p", 22, "Specify port number to connect")
-	connectCmd.Flags().IntVarP(&duration, "duration", "d", 60, "Specify session duration in minutes")
+	connectCmd.Flags().StringVar(&simID, "sim-id", "", "Specify SIM ID to connect to, instead of subscriber name")
+	connectCmd.Flags().BoolVar(&noPTY, "no-pty", false, "Do not allocate PTY for the remote shell, which is implied if stdin or stdout is not a terminal")
+	connectCmd.Flags().StringVar(&term, "term", "", "Specify terminal type of the remote PTY. TERM environment variable, then xterm is used if not specified")
+	connectCmd.Flags().StringVar(&jump, "jump", "", "Connect via specified subscriber as a jump host, i.e. [<user>@]<subscriber name>. Port mappings for the destination permit the jump host. The jump host is connected on port 22")
+	connectCmd.Flags().BoolVar(&reconnect, "reconnect", false, "Reconnect with exponential backoff when the connection is lost, reusing the port mapping if it is still available. Not when the remote shell exits")
+	connectCmd.Flags().IntVar(&maxReconnects, "max-reconnects", 5, "Specify maximum number of reconnect attempts in a row with --reconnect")
+	connectCmd.Flags().BoolVar(&fromList, "from-list", false, "Connect to the existing port mapping created most recently, as shown by list, without creating new one")
+	connectCmd.Flags().BoolVar(&last, "last", false, "Reconnect to the subscriber connected most recently, with the same user and port")
+	connectCmd.Flags().BoolVar(&showTimings, "timings", false, "Show how long each phase took, i.e. API authentication, SIM lookup, port mapping, TCP dial and SSH handshake, after the session ends")
+	connectCmd.Flags().StringVar(&sessionLog, "log-session", "", "Append the output of the remote session to specified file with timestamps while displaying it, e.g. for audit")
+	connectCmd.Flags().BoolVar(&sessionLogInput, "log-session-input", false, "Also record stdin, i.e. keystrokes including passwords typed in the session, to the file of --log-session")
+	connectCmd.Flags().StringVar(&printEndpoint, "print-endpoint", "", "Find or create port mapping, then print it as text, or as JSON with --print-endpoint=json, and exit without connecting, e.g. for another tool. The port mapping is not deleted. Use with --log-format json to keep progress messages out of stdout")
+	connectCmd.Flags().Lookup("print-endpoint").NoOptDefVal = "text"
+	connectCmd.Flags().BoolVar(&evalOutput, "eval", false, "Find or create port mapping like --print-endpoint, then print export NSSH_ENDPOINT=<host>:<port>, NSSH_HOST and NSSH_PORT for eval $(nssh connect ... --eval). Everything else is written to stderr")
+	addLocalForwardFlag(connectCmd)
+	connectCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show whether an existing port mapping is reused or new one is created, without creating port mapping nor connecting")
+	addConnectFlags(connectCmd)
 	return connectCmd
 }
 
-func parseArg(arg string) (string, string) {
-	login := "pi"
-	var name string
+// findOnlineSIM finds the online SIM specified by value of the selector,
+// which is one of selectByName, selectByIMSI, or selectBySIMID
+func findOnlineSIM(selector, value string) (*models.SIM, error) {
+	switch selector {
+	case selectByIMSI:
+		emitter.Emit("sims_searching", map[string]any{"imsi": value}, "search SIM with IMSI %s", value)
+		sim, err := client.FindOnlineSIMByIMSI(value)
+		if err != nil {
+			return nil, fmt.Errorf("nssh: → %w", err)
+		}
+		emitter.Emit("sim_found", map[string]any{"simId": sim.ID, "name": sim.Tags.Name}, "→ found SIM %s", sim)
+		return sim, nil
+	case selectBySIMID:
+		return getOnlineSIM(value)
+	default:
+		return findOnlineSIMByName(value, terminal.IsTerminal(int(os.Stdout.Fd())))
+	}
+}
+
+// findOnlineSIMByName finds the online SIM named name. If there are multiple
+// SIMs with the name, the one with the smallest SIM ID is selected with
+// --select-first. Otherwise, let the user select one of them if interactive,
+// or print their IDs and return an error. Returns nil without an error if the
+// user quits without selection.
+func findOnlineSIMByName(name string, interactive bool) (*models.SIM, error) {
+	emitter.Emit("sims_searching", map[string]any{"name": name}, "search subscribers named \"%s\"", name)
+	onlineSIMs, err := client.FindOnlineSIMsByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("nssh: → failed to find online subscribers named \"%s\": %w", name, err)
+	}
+	if len(onlineSIMs) == 0 {
+		return nil, withExitCode(ExitNotFound, fmt.Errorf("nssh: → failed to find online subscribers named \"%s\"", name))
+	}
+
+	sim := &onlineSIMs[0]
+	if len(onlineSIMs) > 1 && selectFirst {
+		sim = firstSIM(onlineSIMs)
+		emitter.Emit("sim_selected_first", map[string]any{"name": name, "count": len(onlineSIMs), "simId": sim.ID},
+			"→ found %d subscribers named \"%s\", selected %s with the smallest SIM ID as --select-first is specified", len(onlineSIMs), name, sim.ID)
+	} else if len(onlineSIMs) > 1 {
+		emitter.Emit("sims_found", map[string]any{"name": name, "count": len(onlineSIMs)}, "→ found multiple subscribers named \"%s\"", name)
+
+		if !interactive {
+			// print SIM IDs in parseable form, so that scripts can choose one of them with --sim-id
+			for _, s := range onlineSIMs {
+				fmt.Printf("%s\t%s\n", s.ID, s.Tags.Name)
+			}
+			return nil, fmt.Errorf("nssh: → cannot create port mapping as there are multiple subscribers named \"%s\", specify one of them with --sim-id, or --select-first", name)
+		}
+
+		sim, err = selectSIM(fmt.Sprintf("Online Subscribers Named \"%s\"", name), onlineSIMs)
+		if err != nil || sim == nil {
+			return nil, err
+		}
+	}
+
+	emitter.Emit("sim_found", map[string]any{"simId": sim.ID, "name": sim.Tags.Name}, "→ found SIM %s", sim)
+	return sim, nil
+}
+
+// firstSIM returns the SIM with the smallest ID, so that the same one is
+// selected regardless of the order SORACOM API returns them
+func firstSIM(sims []models.SIM) *models.SIM {
+	sim := slices.MinFunc(sims, func(a, b models.SIM) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return &sim
+}
+
+// getOnlineSIM gets the SIM with the ID, and returns an error if it is offline
+func getOnlineSIM(simID string) (*models.SIM, error) {
+	emitter.Emit("sim_getting", map[string]any{"simId": simID}, "get SIM %s", simID)
+	sim, err := client.GetOnlineSIM(simID)
+	if err != nil {
+		return nil, fmt.Errorf("nssh: → %w", err)
+	}
+	emitter.Emit("sim_found", map[string]any{"simId": sim.ID, "name": sim.Tags.Name}, "→ found SIM %s", sim)
+	return sim, nil
+}
+
+// addConnectFlags adds flags shared by the commands which connect to a SIM
+func addConnectFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&identity, "identity", "i", "", "Specify a path to file from which the identity for public key authentication is read")
+	cmd.Flags().BoolVar(&identityStdin, "identity-stdin", false, "Read PEM encoded private key for public key authentication from stdin, instead of file. SORACOM_SSH_KEY environment variable is used if set and neither is specified")
+	cmd.Flags().BoolVar(&agentOnly, "identity-from-agent-only", false, "Authenticate only with keys of the SSH agent at SSH_AUTH_SOCK, and fail instead of reading private key or asking password, e.g. not to let private keys leave the agent")
+	cmd.Flags().StringVar(&passwordFile, "password-file", "", "Specify a path to file whose first line is the password of the device, used instead of asking when no private key is specified. SORACOM_SSH_PASSWORD environment variable is used if not specified")
+	cmd.Flags().StringVar(&certificate, "certificate", "", "Specify a path to OpenSSH certificate signed by SSH CA, e.g. id_ed25519-cert.pub, to present with the private key")
+	cmd.Flags().IntVarP(&port, "port", "p", 22, "Specify port number of SSH server on the device, i.e. destination port of the port mapping, 1-65535. Napter assigns another port to the endpoint")
+	duration = 60
+	cmd.Flags().VarP((*minutesValue)(&duration), "duration", "d", "Specify session duration in minutes, or with unit such as 2h or 90m, 1m-8h")
+	cmd.Flags().StringSliceVar(&sourceCIDRs, "source-cidr", nil, "Specify source CIDR permitted to connect to the port mapping created by nssh. Can be repeated. Current global IP address/32 is used if not specified")
+	cmd.Flags().StringVar(&sourceCIDRFile, "source-cidr-file", "", "Specify a path to file of source CIDRs, one per line with # for comments, e.g. a team allowlist. They are permitted in addition to --source-cidr and current global IP address")
+	cmd.Flags().BoolVar(&noAutoIP, "no-auto-ip", false, "Do not permit current global IP address in addition to --source-cidr-file")
+	cmd.Flags().BoolVar(&tlsRequired, "tls", false, "Use the port mapping which requires TLS, and connect to it over TLS")
+	cmd.Flags().BoolVar(&tlsInsecure, "tls-insecure", false, "Skip verification of the certificate of the port mapping with --tls")
+	cmd.Flags().StringVar(&proxyCommand, "proxy-command", "", "Specify command to connect to the port mapping through, like ProxyCommand of OpenSSH, e.g. \"ssh -W %h:%p bastion\". %h and %p are replaced with the host and the port of the port mapping. Specify --source-cidr of the host which actually connects")
+	cmd.Flags().IntVar(&connectTimeout, "connect-timeout", 0, "Specify timeout in seconds to connect and complete SSH handshake, e.g. for devices slow to present SSH banner, 0 to wait forever")
+	cmd.Flags().IntVar(&serverAliveInterval, "server-alive-interval", 30, "Specify interval in seconds to send keepalive requests to the server, 0 to disable")
+	cmd.Flags().IntVar(&serverAliveCountMax, "server-alive-count-max", 3, "Specify number of keepalive requests which may be unanswered before disconnecting")
+	cmd.Flags().BoolVar(&noTitle, "no-title", false, "Do not set the window title of the terminal to the name and the ID of the SIM during the session")
+	cmd.Flags().BoolVar(&noExpiryWarning, "no-expiry-warning", false, "Do not warn 5 minutes before the port mapping expires")
+	cmd.Flags().IntVar(&maxMappings, "max-mappings", 0, "Warn before creating port mapping if the number of port mappings of the account reaches this, 0 to disable")
+	cmd.Flags().BoolVar(&reuse, "reuse", false, "Delete existing port mappings to the same port which do not permit current IP address, after creating new one which does, not to leave unusable port mappings")
+	addAlgorithmFlags(cmd)
+	cmd.Flags().BoolVar(&yes, "yes", false, "Do not warn when connecting as root")
+	cmd.Flags().BoolVar(&selectFirst, "select-first", false, "Select the subscriber with the smallest SIM ID if multiple online subscribers have the name, instead of asking or failing, e.g. in scripts where any of them is acceptable")
+	cmd.Flags().BoolVar(&cleanup, "cleanup", true, "Delete the port mapping created by nssh when the session ends. Existing port mappings are never deleted")
+}
+
+// addAlgorithmFlags adds flags to choose SSH algorithms, e.g. lighter ones
+// for constrained links
+func addAlgorithmFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&compress, "compress", false, "Not supported, as SSH compression is not available in golang.org/x/crypto/ssh. Choose lighter algorithms with --cipher, --mac and --kex instead")
+	cmd.Flags().StringSliceVar(&ciphers, "cipher", nil, "Specify cipher to allow in order of preference, e.g. chacha20-poly1305@openssh.com or aes128-cbc for legacy devices. Can be repeated. Modern ones are allowed if not specified")
+	cmd.Flags().StringSliceVar(&macs, "mac", nil, "Specify MAC algorithm to allow in order of preference, e.g. hmac-sha2-256-etm@openssh.com. Can be repeated. Modern ones are allowed if not specified")
+	cmd.Flags().StringSliceVar(&keyExchanges, "kex", nil, "Specify key exchange algorithm to allow in order of preference, e.g. curve25519-sha256. Can be repeated. Modern ones are allowed if not specified")
+}
+
+// how long before the port mapping expires to warn, unless --no-expiry-warning
+const expiryWarningBefore = 5 * time.Minute
+
+// connectOptions returns nssh.ConnectOptions built from the flags
+func connectOptions() nssh.ConnectOptions {
+	opts := nssh.ConnectOptions{
+		TLSInsecure:         tlsInsecure,
+		ServerAliveInterval: time.Duration(serverAliveInterval) * time.Second,
+		ServerAliveCountMax: serverAliveCountMax,
+		Term:                term,
+		NoPTY:               noPTY,
+		IdentityPEM:         identityPEM,
+		Password:            password,
+		AgentOnly:           agentOnly,
+		Certificate:         certificate,
+		Timings:             timings,
+		SessionLogInput:     sessionLogInput,
+		Ciphers:             ciphers,
+		MACs:                macs,
+		KeyExchanges:        keyExchanges,
+		Timeout:             time.Duration(connectTimeout) * time.Second,
+	}
+	if sessionLogWriter != nil {
+		// not to set typed nil to the interface
+		opts.SessionLog = sessionLogWriter
+	}
+	if !noExpiryWarning {
+		opts.ExpiryWarning = expiryWarningBefore
+	}
+	if proxyCommand != "" {
+		opts.Dialer = nssh.ProxyCommandDialer(proxyCommand, os.Stderr)
+	}
+	return opts
+}
+
+// connectToSIM finds an available port mapping for the SIM, or creates new
+// one, then connects to the SIM via SSH
+func connectToSIM(login string, sim models.SIM) error {
+	if dryRun {
+		return planPortMapping(login, sim)
+	}
+	if printEndpoint != "" {
+		return printPortMapping(sim)
+	}
+	if login == "root" && !yes {
+		emitter.Emit("root_login", map[string]any{"simId": sim.ID}, "→ connect as root. Devices on Napter may be exposed, so consider less privileged user. Specify --yes to suppress this warning")
+	}
+
+	opts := connectOptions()
+	if jump != "" && proxyCommand != "" {
+		return errors.New("nssh: cannot specify both --jump and --proxy-command")
+	}
+	if jump != "" {
+		jumpClient, releaseJump, err := dialJumpHost()
+		if releaseJump != nil {
+			defer releaseJump()
+		}
+		if err != nil {
+			return err
+		}
+		defer jumpClient.Close()
+		opts.Dialer = jumpClient.Dial
+		defer checkIPVia(jumpClient)()
+	}
+
+	release, err := connectOnce(login, sim, opts)
+	release()
+	if reconnect && errors.Is(err, nssh.ErrConnectionLost) {
+		return reconnectToSIM(login, sim, opts, err)
+	}
+	return withConnectHint(login, err)
+}
+
+// withConnectHint adds guidance to err if connecting to the device failed,
+// telling whether the device rejected authentication, e.g. as the user does
+// not exist on the device, or could not be reached
+func withConnectHint(login string, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, nssh.ErrAuthFailed):
+		how := "<user>@"
+		if hasLoginFlag {
+			how += " or -u"
+		}
+		return fmt.Errorf("%w\nnssh: check the identity with -i or the password. The user %s may not exist on this device, specify another one with %s", err, login, how)
+	case unreachable(err):
+		return fmt.Errorf("%w\nnssh: failed to reach SSH server of the device. Check that it is listening on the port specified with --port, and the port mapping has not expired", err)
+	default:
+		return err
+	}
+}
+
+// printPortMapping ensures port mapping for the SIM, and prints it as
+// --print-endpoint or --eval without connecting
+func printPortMapping(sim models.SIM) error {
+	portMapping, _, err := ensurePortMapping(sim, port)
+	if err != nil {
+		return err
+	}
+
+	switch printEndpoint {
+	case "json":
+		b, err := json.MarshalIndent(portMapping, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	case "eval":
+		host, port, err := net.SplitHostPort(portMapping.SSHTarget())
+		if err != nil {
+			return fmt.Errorf("nssh: unexpected endpoint %s: %w", portMapping.SSHTarget(), err)
+		}
+		_, _ = fmt.Fprintf(evalStdout, "export NSSH_ENDPOINT=%s\nexport NSSH_HOST=%s\nexport NSSH_PORT=%s\n", portMapping.SSHTarget(), host, port)
+		return nil
+	}
+	fmt.Printf("%s\n- Connect: nssh ssh %s\n", portMapping, portMapping.SSHTarget())
+	return nil
+}
+
+// initial and maximum wait before reconnecting with --reconnect
+const (
+	reconnectInitialWait = time.Second
+	reconnectMaxWait     = time.Minute
+)
+
+// reconnectToSIM reconnects to the SIM after the connection is lost, waiting
+// exponentially longer between the attempts, until the remote shell exits or
+// --max-reconnects attempts in a row fail
+func reconnectToSIM(login string, sim models.SIM, opts nssh.ConnectOptions, err error) error {
+	wait := reconnectInitialWait
+	for attempt := 1; attempt <= maxReconnects; attempt++ {
+		emitter.Emit("reconnecting", map[string]any{"simId": sim.ID, "attempt": attempt, "maxAttempts": maxReconnects, "wait": wait.String(), "error": err},
+			"→ %v, reconnect in %s (%d/%d)", err, wait, attempt, maxReconnects)
+		time.Sleep(wait)
+		wait = min(wait*2, reconnectMaxWait)
+
+		var release func()
+		release, err = connectOnce(login, sim, opts)
+		// release each port mapping once the session on it ends, not to pile
+		// up until all attempts end
+		release()
+
+		var exitError *ssh.ExitError
+		if err == nil || errors.As(err, &exitError) {
+			return err
+		}
+		if errors.Is(err, nssh.ErrConnectionLost) {
+			// the session was established again, so start over
+			attempt, wait = 0, reconnectInitialWait
+		}
+	}
+	return err
+}
+
+// connectOnce finds an available port mapping for the SIM, or creates new one,
+// then connects to the SIM via SSH. Returned function releases the port
+// mapping as ensurePortMapping, and is never nil.
+func connectOnce(login string, sim models.SIM, opts nssh.ConnectOptions) (func(), error) {
+	start := time.Now()
+	portMapping, release, err := func() (*models.PortMapping, func(), error) {
+		if fromList {
+			pm, err := latestPortMapping(sim, port)
+			return pm, func() {}, err
+		}
+		return ensurePortMapping(sim, port)
+	}()
+	if err != nil {
+		return func() {}, err
+	}
+	timings.Record("port mapping", start)
+	if expiresAt, ok := portMapping.ExpiresAt(); ok {
+		emitter.Emit("port_mapping_expiry", map[string]any{"endpoint": portMapping.Endpoint, "expiresAt": expiresAt.Format(time.RFC3339)},
+			"→ the port mapping expires at %s, in %s", expiresAt.Format(time.Kitchen), time.Until(expiresAt).Round(time.Minute))
+	}
+	logger.Debug("use port mapping", "endpoint", portMapping.Endpoint, "tls", portMapping.TLSRequired, "sourceCIDRs", portMapping.Source.IPRanges)
 
-	if strings.Contains(arg, "@") {
-		s := strings.SplitN(arg, "@", 2)
-		if s[0] != "" {
-			login = s[0]
-			name = s[1]
-		} else {
-			name = s[1]
+	emitter.Emit("connecting", map[string]any{"login": login, "simId": sim.ID, "port": port, "endpoint": portMapping.Endpoint}, "connect to %s@%s:%d using the port mapping\n%s", login, sim.ID, port, strings.Repeat("-", 40))
+	if !noTitle {
+		opts.Title = windowTitle(sim)
+	}
+	usage := &nssh.Usage{}
+	opts.Usage = usage
+	if len(forwards) == 0 {
+		err = client.Connect(login, identity, portMapping, opts)
+	} else {
+		err = shellWithForwards(login, portMapping, opts)
+	}
+	if usage.Duration() > 0 {
+		emitter.Emit("session_usage", map[string]any{"simId": sim.ID, "sentBytes": usage.Sent(), "receivedBytes": usage.Received(), "durationMs": usage.Duration().Milliseconds()},
+			"→ sent %s, received %s, duration %s", nssh.FormatBytes(usage.Sent()), nssh.FormatBytes(usage.Received()), usage.Duration().Round(time.Second))
+	}
+
+	// the session was established if the remote command exited, or the
+	// connection was lost after that
+	var exitError *ssh.ExitError
+	if err == nil || errors.As(err, &exitError) || errors.Is(err, nssh.ErrConnectionLost) {
+		if err := nssh.SaveLastConnection(profileName, &nssh.LastConnection{SIMID: sim.ID, Login: login, Port: port}); err != nil {
+			logger.Debug("failed to save the last connection", "error", err)
 		}
+	}
+	return release, err
+}
+
+// shellWithForwards connects to the port mapping, and opens a shell while
+// forwarding the local ports of -L through the same connection
+func shellWithForwards(login string, portMapping *models.PortMapping, opts nssh.ConnectOptions) error {
+	sshClient, err := client.Dial(login, identity, portMapping, opts)
+	if err != nil {
+		return err
+	}
+	defer sshClient.Close()
+	emitter.Emit("connected", map[string]any{"login": login, "endpoint": portMapping.Endpoint}, "")
+
+	listeners, err := client.Forward(sshClient, forwards)
+	if err != nil {
+		return err
+	}
+	defer listeners.Close()
+	return client.Shell(sshClient, portMapping, opts)
+}
+
+// windowTitle returns the window title during the session with the SIM, to
+// tell which device the terminal is connected to
+func windowTitle(sim models.SIM) string {
+	if sim.Tags.Name == "" {
+		return fmt.Sprintf("nssh: %s", sim.ID)
+	}
+	return fmt.Sprintf("nssh: %s (%s)", sim.Tags.Name, sim.ID)
+}
+
+// reportTimings shows the phases recorded with --timings
+func reportTimings() {
+	if timings == nil {
+		return
+	}
+	var phases []map[string]any
+	for _, p := range timings.Phases() {
+		phases = append(phases, map[string]any{"phase": p.Phase, "ms": p.Duration.Milliseconds()})
+	}
+	emitter.Emit("timings", map[string]any{"phases": phases}, "timings:\n%s", timings)
+}
+
+// lastConnection returns the last connection to reconnect, or nil if there is
+// no last connection. If ask is true, the user is asked whether to reconnect
+// when stdin is a terminal, and nil is returned unless the user agrees.
+func lastConnection(ask bool) (*nssh.LastConnection, error) {
+	lc, err := nssh.LoadLastConnection(profileName)
+	if err != nil {
+		return nil, fmt.Errorf("nssh: failed to load the last connection: %w", err)
+	}
+	if lc == nil || !ask {
+		return lc, nil
+	}
+
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, nil
+	}
+	fmt.Printf("nssh: reconnect to %s@%s:%d? [y/N] ", lc.Login, lc.SIMID, lc.Port)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+		return nil, nil
+	}
+	return lc, nil
+}
+
+// ensurePortMapping finds an available port mapping for the SIM and dstPort,
+// or creates new one. Returned function deletes the port mapping if it is created by this
+// call and cleanup is enabled, otherwise does nothing.
+func ensurePortMapping(sim models.SIM, dstPort int) (*models.PortMapping, func(), error) {
+	warnPortMappingLimit()
+	ensure := func() (*models.PortMapping, bool, error) {
+		return client.EnsurePortMapping(sim, dstPort, duration, portMappingSourceCIDRs(), tlsRequired)
+	}
+	var portMapping *models.PortMapping
+	var created bool
+	var err error
+	if cleanup {
+		portMapping, created, err = tracker.create(ensure)
 	} else {
-		name = arg
+		portMapping, created, err = ensure()
+	}
+	if err != nil {
+		return nil, nil, withExitCode(ExitMapping, withPortMappingLimitHint(err))
+	}
+	if created {
+		replaceStalePortMappings(sim, portMapping)
+	}
+
+	if !created || !cleanup {
+		return portMapping, func() {}, nil
+	}
+	return portMapping, func() { tracker.release(portMapping) }, nil
+}
+
+// replaceStalePortMappings deletes the other port mappings to the same port as
+// created, which were not available as they do not permit current IP address,
+// if --reuse is specified. Suggests --reuse if not.
+func replaceStalePortMappings(sim models.SIM, created *models.PortMapping) {
+	// unless current IP address is known, the others might be available
+	ip, err := client.IPChecker().GetIP()
+	if err != nil {
+		return
+	}
+	portMappings, err := client.FindPortMappingsForSIM(sim)
+	if err != nil {
+		return
+	}
+
+	for i := range portMappings {
+		pm := &portMappings[i]
+		if pm.Endpoint == created.Endpoint || pm.Destination.Port != created.Destination.Port || pm.TLSRequired != created.TLSRequired || pm.AllowsIP(ip) {
+			continue
+		}
+		if !reuse {
+			emitter.Emit("port_mapping_stale", map[string]any{"endpoint": pm.Endpoint}, "→ port mapping %s to the same port exists, but does not permit current IP address. Specify --reuse to replace it", pm.Endpoint)
+			continue
+		}
+		deletePortMapping(pm)
+	}
+}
+
+// latestPortMapping returns the port mapping for the SIM and dstPort created
+// most recently, as shown by list, without creating new one
+func latestPortMapping(sim models.SIM, dstPort int) (*models.PortMapping, error) {
+	emitter.Emit("port_mappings_searching", map[string]any{"simId": sim.ID, "port": dstPort}, "search existing port mappings for %s:%d", sim.ID, dstPort)
+	portMappings, err := client.FindPortMappingsForSIM(sim)
+	if err != nil {
+		return nil, err
+	}
+
+	var latest *models.PortMapping
+	for i, pm := range portMappings {
+		if pm.Destination.Port == dstPort && pm.TLSRequired == tlsRequired && (latest == nil || pm.CreatedTime > latest.CreatedTime) {
+			latest = &portMappings[i]
+		}
+	}
+	if latest == nil {
+		return nil, withExitCode(ExitMapping, fmt.Errorf("nssh: → no port mapping for %s:%d, connect without --from-list to create one", sim.ID, dstPort))
+	}
+	emitter.Emit("port_mapping_found", map[string]any{"simId": sim.ID, "endpoint": latest.Endpoint}, "→ found available port mapping:\n%s", latest)
+	return latest, nil
+}
+
+// planPortMapping shows what connectToSIM would do for the SIM, without
+// creating port mapping nor connecting
+func planPortMapping(login string, sim models.SIM) error {
+	emitter.Emit("port_mappings_searching", map[string]any{"simId": sim.ID, "port": port}, "search existing port mappings for %s:%d", sim.ID, port)
+
+	available, err := client.FindAvailablePortMappingsForSIM(sim, port, tlsRequired)
+	if err == nil && len(available) > 0 {
+		portMapping := &available[0]
+		emitter.Emit("dry_run", map[string]any{"action": "reuse", "login": login, "simId": sim.ID, "endpoint": portMapping.Endpoint},
+			"dry run: would reuse the port mapping, then connect as %s:\n%s", login, portMapping)
+		return nil
+	}
+
+	cidrs, err := client.ResolveSourceCIDRs(portMappingSourceCIDRs())
+	if err != nil {
+		return err
+	}
+	source := strings.Join(cidrs, ",")
+	if source == "" {
+		source = "SORACOM API default"
+	}
+	emitter.Emit("dry_run", map[string]any{"action": "create", "login": login, "simId": sim.ID, "port": port, "duration": duration, "sourceCIDRs": cidrs, "tlsRequired": tlsRequired, "cleanup": cleanup},
+		"dry run: would create port mapping for %s:%d, then connect as %s:\n- Duration: %d minutes\n- Source: %s\n- TLS required: %v\n- Delete after the session: %v", sim.ID, port, login, duration, source, tlsRequired, cleanup)
+	return nil
+}
+
+// selectors of the subscriber in the argument
+const (
+	selectByName  = "name"
+	selectByIMSI  = "imsi"
+	selectBySIMID = "sim"
+)
+
+// defaultLogin returns SORACOM_DEFAULT_USER environment variable, or "pi" if
+// not set
+func defaultLogin() string {
+	if v := os.Getenv("SORACOM_DEFAULT_USER"); v != "" {
+		return v
+	}
+	return "pi"
+}
+
+// parseArg parses [<user>@][<selector>:]<value> into the login user name, the
+// selector and the value. The login defaults to defaultLogin, and the selector
+// defaults to selectByName. See splitLogin for names containing @.
+func parseArg(arg string) (string, string, string) {
+	login, target := splitLogin(arg)
+	if login == "" {
+		login = defaultLogin()
+	}
+
+	selector, value := parseSelector(target)
+	return login, selector, value
+}
+
+// splitLogin splits arg at the first @ into the login user name and the
+// rest. The login is empty if not specified, i.e. arg has no @, starts with
+// @, or starts with name:, imsi: or sim:. So a subscriber named a@b is
+// specified as @a@b, name:a@b or pi@a@b, not a@b which means user a.
+func splitLogin(arg string) (string, string) {
+	if _, value := parseSelector(arg); value != arg {
+		return "", arg
+	}
+	login, target, ok := strings.Cut(arg, "@")
+	if !ok {
+		return "", arg
+	}
+	return login, target
+}
+
+// loginOf returns the login user name of arg, or of -u if arg has none, and
+// whether either is specified, with the rest of arg. The user in arg takes
+// precedence over -u, as it is more specific.
+func loginOf(flags *pflag.FlagSet, arg string) (string, bool, string) {
+	user, target := splitLogin(arg)
+	if user != "" {
+		return user, true, target
+	}
+	return login, flags.Changed("login"), target
+}
+
+// parseSelector splits name:, imsi: or sim: prefix from target, and returns
+// selectByName and target as is if it has no such prefix
+func parseSelector(target string) (string, string) {
+	for _, selector := range []string{selectByName, selectByIMSI, selectBySIMID} {
+		if v, ok := strings.CutPrefix(target, selector+":"); ok {
+			return selector, v
+		}
 	}
-	return login, name
+	return selectByName, target
 }
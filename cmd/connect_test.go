@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/0x6b/nssh"
+	"github.com/0x6b/nssh/models"
+	"github.com/spf13/pflag"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// roundTripperFunc is http.RoundTripper of a function
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestWithConnectHint(t *testing.T) {
+	authFailed := fmt.Errorf("failed to connect: %w", nssh.ErrAuthFailed)
+	tests := []struct {
+		name         string
+		hasLoginFlag bool
+		err          error
+		want         string
+		notWant      string
+	}{
+		{name: "without -u", err: authFailed, want: "specify another one with <user>@\n", notWant: "-u"},
+		{name: "with -u", hasLoginFlag: true, err: authFailed, want: "specify another one with <user>@ or -u\n"},
+		{name: "other error", err: errors.New("other"), want: "other\n", notWant: "nssh:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hasLoginFlag = tt.hasLoginFlag
+			t.Cleanup(func() { hasLoginFlag = false })
+
+			err := withConnectHint("pi", tt.err)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("withConnectHint() = %v, want wrapping %v", err, tt.err)
+			}
+			got := err.Error() + "\n"
+			if !strings.Contains(got, tt.want) || tt.notWant != "" && strings.Contains(got, tt.notWant) {
+				t.Errorf("withConnectHint() = %q, want %q without %q", got, tt.want, tt.notWant)
+			}
+		})
+	}
+
+	if err := withConnectHint("pi", nil); err != nil {
+		t.Errorf("withConnectHint(nil) = %v, want nil", err)
+	}
+}
+
+func TestLatestPortMappingForPort(t *testing.T) {
+	var pms []models.PortMapping
+	if err := json.Unmarshal([]byte(`[
+		{"endpoint": "192.0.2.10:1", "createdTime": 1, "destination": {"simId": "8981100000000000001", "port": 22}},
+		{"endpoint": "192.0.2.10:2", "createdTime": 2, "destination": {"simId": "8981100000000000001", "port": 2222}},
+		{"endpoint": "192.0.2.10:3", "createdTime": 3, "destination": {"simId": "8981100000000000001", "port": 22}}
+	]`), &pms); err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(pms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(b)), Request: req}, nil
+	})
+
+	t.Setenv("SORACOM_API_KEY", "api-key")
+	t.Setenv("SORACOM_TOKEN", "token")
+	emitter = nssh.NewTextEmitter(io.Discard, "en")
+	c, err := nssh.NewSoracomClient("jp", "", nssh.WithTransport(transport), nssh.WithEmitter(emitter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = c
+	t.Cleanup(func() { client, emitter = nil, nil })
+
+	sim := models.SIM{ID: "8981100000000000001"}
+	for p, want := range map[int]string{22: "192.0.2.10:3", 2222: "192.0.2.10:2"} {
+		pm, err := latestPortMapping(sim, p)
+		if err != nil || pm.Destination.Port != p || pm.Endpoint != want {
+			t.Errorf("latestPortMapping(%d) = %v, %v, want %s", p, pm, err, want)
+		}
+	}
+	if pm, err := latestPortMapping(sim, 8022); err == nil {
+		t.Errorf("latestPortMapping() of port without port mapping = %v, want error", pm)
+	}
+}
+
+func TestParseArg(t *testing.T) {
+	t.Setenv("SORACOM_DEFAULT_USER", "")
+	tests := []struct {
+		arg                    string
+		login, selector, value string
+	}{
+		{arg: "gateway", login: "pi", selector: selectByName, value: "gateway"},
+		{arg: "ubuntu@gateway", login: "ubuntu", selector: selectByName, value: "gateway"},
+		{arg: "@gateway", login: "pi", selector: selectByName, value: "gateway"},
+		{arg: "a@b", login: "a", selector: selectByName, value: "b"},
+		{arg: "@a@b", login: "pi", selector: selectByName, value: "a@b"},
+		{arg: "ubuntu@a@b", login: "ubuntu", selector: selectByName, value: "a@b"},
+		{arg: "name:a@b", login: "pi", selector: selectByName, value: "a@b"},
+		{arg: "ubuntu@name:a@b", login: "ubuntu", selector: selectByName, value: "a@b"},
+		{arg: "imsi:440100000000001", login: "pi", selector: selectByIMSI, value: "440100000000001"},
+		{arg: "ubuntu@sim:8981100000000000001", login: "ubuntu", selector: selectBySIMID, value: "8981100000000000001"},
+		{arg: "my device", login: "pi", selector: selectByName, value: "my device"},
+		{arg: "ubuntu@my device", login: "ubuntu", selector: selectByName, value: "my device"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			login, selector, value := parseArg(tt.arg)
+			if login != tt.login || selector != tt.selector || value != tt.value {
+				t.Errorf("parseArg(%q) = %q, %q, %q, want %q, %q, %q", tt.arg, login, selector, value, tt.login, tt.selector, tt.value)
+			}
+		})
+	}
+
+	t.Setenv("SORACOM_DEFAULT_USER", "admin")
+	if login, _, _ := parseArg("gateway"); login != "admin" {
+		t.Errorf("parseArg() = %q, want SORACOM_DEFAULT_USER", login)
+	}
+}
+
+func TestLoginOf(t *testing.T) {
+	tests := []struct {
+		name          string
+		flags         []string
+		arg           string
+		login, target string
+		specified     bool
+	}{
+		{name: "default", arg: "gateway", login: "pi", target: "gateway"},
+		{name: "user in arg", arg: "ubuntu@gateway", login: "ubuntu", target: "gateway", specified: true},
+		{name: "-u", flags: []string{"-u", "ubuntu"}, arg: "gateway", login: "ubuntu", target: "gateway", specified: true},
+		{name: "--login", flags: []string{"--login=ubuntu"}, arg: "gateway", login: "ubuntu", target: "gateway", specified: true},
+		{name: "user in arg over -u", flags: []string{"-u", "ubuntu"}, arg: "admin@gateway", login: "admin", target: "gateway", specified: true},
+		{name: "-u with name containing @", flags: []string{"-u", "ubuntu"}, arg: "name:a@b", login: "ubuntu", target: "name:a@b", specified: true},
+		{name: "empty user with -u", flags: []string{"-u", "ubuntu"}, arg: "@a@b", login: "ubuntu", target: "a@b", specified: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(func() { login = "" })
+			flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			flags.StringVarP(&login, "login", "u", "pi", "")
+			if err := flags.Parse(tt.flags); err != nil {
+				t.Fatal(err)
+			}
+
+			got, specified, target := loginOf(flags, tt.arg)
+			if got != tt.login || specified != tt.specified || target != tt.target {
+				t.Errorf("loginOf(%v, %q) = %q, %v, %q, want %q, %v, %q", tt.flags, tt.arg, got, specified, target, tt.login, tt.specified, tt.target)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// A controlRequest is sent by exec --control to the tunnel, as a JSON line
+type controlRequest struct {
+	Command string `json:"command"`
+}
+
+// frame types sent by the tunnel to exec --control. Each frame consists of
+// the type, length of the payload in 4 bytes big endian, and the payload.
+const (
+	frameStdout byte = 'o'
+	frameStderr byte = 'e'
+	frameExit   byte = 'x' // payload is the exit code in 4 bytes big endian
+)
+
+// serveControl accepts connections from exec --control on l, and runs the
+// requested command in new session of sshClient for each of them, until l is
+// closed
+func serveControl(l net.Listener, sshClient *ssh.Client) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go handleControl(conn, sshClient)
+	}
+}
+
+// handleControl runs the command requested on conn, and sends its output and
+// exit code back
+func handleControl(conn net.Conn, sshClient *ssh.Client) {
+	defer conn.Close()
+
+	var req controlRequest
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&req); err != nil {
+		logger.Debug("invalid control request", "error", err)
+		return
+	}
+	logger.Debug("control request", "command", req.Command)
+
+	var mu sync.Mutex
+	stdout := &frameWriter{mu: &mu, w: conn, frameType: frameStdout}
+	stderr := &frameWriter{mu: &mu, w: conn, frameType: frameStderr}
+
+	err := func() error {
+		session, err := sshClient.NewSession()
+		if err != nil {
+			return err
+		}
+		defer session.Close()
+		session.Stdout = stdout
+		session.Stderr = stderr
+		return session.Run(req.Command)
+	}()
+	var exitError *ssh.ExitError
+	if err != nil && !errors.As(err, &exitError) {
+		_, _ = fmt.Fprintf(stderr, "nssh: %v\n", err)
+	}
+
+	code := make([]byte, 4)
+	binary.BigEndian.PutUint32(code, uint32(exitCode(err)))
+	_ = writeFrame(conn, &mu, frameExit, code)
+}
+
+// runViaControl runs command via the tunnel listening on socket, writes its
+// output to stdout and stderr, and returns its exit code
+func runViaControl(socket, command string) (int, error) {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to the tunnel, start it with `nssh tunnel`: %w", err)
+	}
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(controlRequest{Command: command}); err != nil {
+		return 0, err
+	}
+
+	r := bufio.NewReader(conn)
+	header := make([]byte, 5)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return 0, fmt.Errorf("the tunnel closed the connection: %w", err)
+		}
+		payload := make([]byte, binary.BigEndian.Uint32(header[1:]))
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return 0, fmt.Errorf("the tunnel closed the connection: %w", err)
+		}
+
+		switch header[0] {
+		case frameStdout:
+			_, _ = os.Stdout.Write(payload)
+		case frameStderr:
+			_, _ = os.Stderr.Write(payload)
+		case frameExit:
+			return int(binary.BigEndian.Uint32(payload)), nil
+		}
+	}
+}
+
+// A frameWriter writes to w as frames of frameType, holding mu so that frames
+// of stdout and stderr are not mixed
+type frameWriter struct {
+	mu        *sync.Mutex
+	w         io.Writer
+	frameType byte
+}
+
+func (f *frameWriter) Write(b []byte) (int, error) {
+	if err := writeFrame(f.w, f.mu, f.frameType, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func writeFrame(w io.Writer, mu *sync.Mutex, frameType byte, payload []byte) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	header := make([]byte, 5)
+	header[0] = frameType
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// listenControl listens on unix socket at path, accessible only by the user.
+// The socket is created in new directory accessible only by the user, and
+// moved to path after its permission is restricted, so that other users cannot
+// connect to it in between.
+func listenControl(path string) (net.Listener, error) {
+	if _, err := os.Lstat(path); err == nil {
+		return nil, fmt.Errorf("%s already exists", path)
+	}
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".nssh-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, "s")
+	l, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err = os.Chmod(tmp, 0600); err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = l.Close()
+		return nil, err
+	}
+	return &controlListener{Listener: l, path: path}, nil
+}
+
+// A controlListener removes the socket at path on Close, as it is moved from
+// where it is created
+type controlListener struct {
+	net.Listener
+	path string
+}
+
+func (l *controlListener) Close() error {
+	err := l.Listener.Close()
+	_ = os.Remove(l.path)
+	return err
+}
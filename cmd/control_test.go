@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenControl(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "control.sock")
+
+	l, err := listenControl(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode()&os.ModeSocket == 0 || fi.Mode().Perm() != 0600 {
+		t.Errorf("mode of the socket = %v, want socket with 0600", fi.Mode())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("entries in the directory = %v, want only the socket", entries)
+	}
+
+	if _, err := listenControl(path); err == nil {
+		t.Error("listenControl() on existing socket = nil, want error")
+	}
+
+	if err := l.Close(); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("socket is not removed on Close: %v", err)
+	}
+}
+
+func TestRunViaControlWithoutTunnel(t *testing.T) {
+	_, err := runViaControl(filepath.Join(t.TempDir(), "control.sock"), "true")
+	if code := exitCodeOf(err); code != ExitConnect {
+		t.Errorf("exit code = %d, want %d: %v", code, ExitConnect, err)
+	}
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/0x6b/nssh"
+	"github.com/spf13/cobra"
+	"net/http"
+	"strings"
+)
+
+var (
+	maxMappings int
+	deletePort  int
+)
+
+func deleteCmd() *cobra.Command {
+	deleteCmd := &cobra.Command{
+		Use:   "delete <subscriber name>",
+		Short: "Delete port mappings for specified subscriber.",
+		Long:  "Delete port mappings for the subscribers with specified name, e.g. to free port mappings when the limit is reached. With --port, only the port mappings to the port are deleted.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			entries, err := listPortMappingsByName(args[0])
+			if err != nil {
+				exitWithError(err)
+			}
+
+			n := 0
+			for _, e := range entries {
+				for i := range e.portMappings {
+					pm := &e.portMappings[i]
+					if deletePort != 0 && pm.Destination.Port != deletePort {
+						continue
+					}
+					deletePortMapping(pm)
+					n++
+				}
+			}
+			if n == 0 {
+				fmt.Printf("nssh: no port mapping to delete for %s\n", args[0])
+			}
+		},
+	}
+
+	deleteCmd.Flags().IntVarP(&deletePort, "port", "p", 0, "Delete only the port mappings to specified port, 0 for all ports")
+	return deleteCmd
+}
+
+// warnPortMappingLimit warns if new port mapping would reach --max-mappings
+func warnPortMappingLimit() {
+	if maxMappings <= 0 {
+		return
+	}
+	portMappings, err := client.ListPortMappings()
+	if err != nil {
+		return
+	}
+	if n := len(portMappings); n+1 >= maxMappings {
+		emitter.Emit("port_mapping_limit_near", map[string]any{"count": n, "max": maxMappings},
+			"→ %d of %d port mappings are in use, delete unused ones with `nssh delete <subscriber name>`", n, maxMappings)
+	}
+}
+
+// withPortMappingLimitHint adds guidance to err if creating port mapping
+// failed as the number of port mappings reached the limit of the account
+func withPortMappingLimitHint(err error) error {
+	var apiError *nssh.APIError
+	if !errors.As(err, &apiError) || apiError.StatusCode < http.StatusBadRequest || apiError.StatusCode >= http.StatusInternalServerError {
+		return err
+	}
+	msg := strings.ToLower(apiError.Message)
+	if !strings.Contains(msg, "limit") && !strings.Contains(msg, "maximum") && !strings.Contains(msg, "exceed") {
+		return err
+	}
+	return fmt.Errorf("%w\nnssh: too many port mappings, find unused ones with `nssh list` and delete them with `nssh delete <subscriber name>`", err)
+}
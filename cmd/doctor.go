@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/0x6b/nssh"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+// A check represents result of a check by doctor command. err is nil if
+// passed, and skipped checks have skip instead.
+type check struct {
+	name string
+	info string
+	skip string
+	err  error
+	hint string
+}
+
+func doctorCmd() *cobra.Command {
+	doctorCmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check credentials and connectivity to SORACOM API.",
+		Long:  "Check the profile, connectivity to SORACOM API endpoint, authentication, current global IP address, and permission to list port mappings in order, and print the results with hints to fix failures. Checks which depend on a failed one are skipped.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			failed := 0
+			for _, c := range runChecks() {
+				switch {
+				case c.skip != "":
+					fmt.Printf("[SKIP] %s: %s\n", c.name, c.skip)
+				case c.err != nil:
+					failed++
+					fmt.Printf("[FAIL] %s: %v\n", c.name, c.err)
+					fmt.Printf("       → %s\n", c.hint)
+				default:
+					fmt.Printf("[PASS] %s: %s\n", c.name, c.info)
+				}
+			}
+			if failed > 0 {
+				os.Exit(1)
+			}
+		},
+	}
+	return doctorCmd
+}
+
+// runChecks runs the checks in order, skipping the ones which depend on a
+// failed check
+func runChecks() []check {
+	profile := check{name: "Profile"}
+	switch {
+	case os.Getenv("SORACOM_API_KEY") != "" && os.Getenv("SORACOM_TOKEN") != "":
+		profile.skip = "SORACOM_API_KEY and SORACOM_TOKEN environment variables are used"
+	case os.Getenv("SORACOM_AUTH_KEY_ID") != "" && os.Getenv("SORACOM_AUTH_KEY") != "":
+		profile.skip = "SORACOM_AUTH_KEY_ID and SORACOM_AUTH_KEY environment variables are used"
+	default:
+		if p, err := nssh.LoadProfile(profileName); err != nil {
+			profile.err = err
+			profile.hint = "create the profile as described in One-time Setup of README, or specify another one with --profile-name"
+		} else {
+			profile.info = fmt.Sprintf("\"%s\", coverage type %s, auth key ID %s", p.Name, p.CoverageType, mask(p.AuthKeyID))
+		}
+	}
+	if profile.err != nil {
+		return []check{profile, skipped("SORACOM API"), skipped("Authentication"), skipped("Current IP address"), skipped("Port mappings")}
+	}
+
+	endpoint, auth := checkAuth()
+	if client == nil {
+		return []check{profile, endpoint, auth, skipped("Current IP address"), skipped("Port mappings")}
+	}
+
+	ip := check{name: "Current IP address"}
+	if v, err := client.IPChecker().GetIP(); err != nil {
+		ip.err = err
+		ip.hint = "check --checkip-url or NSSH_CHECKIP_URL environment variable, or specify --source-cidr when connecting"
+	} else {
+		ip.info = v.String()
+	}
+
+	portMappings := check{name: "Port mappings"}
+	if v, err := client.ListPortMappings(); err != nil {
+		portMappings.err = err
+		portMappings.hint = "permit the SAM user to list port mappings, as described in One-time Setup of README"
+	} else {
+		portMappings.info = fmt.Sprintf("%d in use", len(v))
+	}
+	return []check{profile, endpoint, auth, ip, portMappings}
+}
+
+// checkAuth creates the client with new token, and returns the results of
+// reaching SORACOM API and authentication. client is nil if either fails.
+func checkAuth() (check, check) {
+	endpoint, auth := check{name: "SORACOM API"}, check{name: "Authentication"}
+
+	options, err := clientOptions()
+	if err != nil {
+		endpoint.err = err
+		endpoint.hint = "check --proxy and --ca-cert"
+		return endpoint, skipped(auth.name)
+	}
+	// authenticate without the cached token to check the credentials
+	options = append(options, nssh.WithoutTokenCache())
+
+	c, err := nssh.NewSoracomClient(coverageType, profileName, options...)
+	var apiError *nssh.APIError
+	switch {
+	case err == nil:
+		client = c
+		endpoint.info = c.Endpoint
+		auth.info = "succeeded"
+		if os.Getenv("SORACOM_API_KEY") != "" && os.Getenv("SORACOM_TOKEN") != "" {
+			auth.info = "API key and token are used as is, and checked by the following checks"
+		}
+	case errors.As(err, &apiError):
+		endpoint.info = "reachable"
+		auth.err = err
+		auth.hint = "check the auth key ID and the auth key are correct and active, and the coverage type of the profile or --coverage-type"
+	default:
+		endpoint.err = err
+		endpoint.hint = "check network connection, --proxy or HTTPS_PROXY environment variable, --ca-cert for TLS-intercepting proxy, and --coverage-type or --endpoint"
+		auth = skipped(auth.name)
+	}
+	return endpoint, auth
+}
+
+// skipped returns the check skipped as a check which it depends on failed
+func skipped(name string) check {
+	return check{name: name, skip: "skipped as the previous check failed"}
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/0x6b/nssh"
+	"strconv"
+	"time"
+)
+
+// A minutesValue is a flag value of duration in minutes, which accepts Go
+// duration string such as 2h or 90m, as well as a bare integer of minutes, up
+// to the maximum duration of port mapping
+type minutesValue int
+
+func (m *minutesValue) String() string {
+	return strconv.Itoa(int(*m))
+}
+
+func (m *minutesValue) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("specify minutes, or duration such as 2h or 90m")
+		}
+		if d%time.Minute != 0 {
+			return fmt.Errorf("specify whole minutes")
+		}
+		n = int(d / time.Minute)
+	}
+
+	if n < nssh.MinPortMappingDuration || n > nssh.MaxPortMappingDuration {
+		return fmt.Errorf("specify %dm-%dh", nssh.MinPortMappingDuration, nssh.MaxPortMappingDuration/60)
+	}
+	*m = minutesValue(n)
+	return nil
+}
+
+func (m *minutesValue) Type() string {
+	return "duration"
+}
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/0x6b/nssh/models"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/sync/errgroup"
+	"io"
+	"os"
+	"sync"
+)
+
+var (
+	execCommand string
+	parallel    int
+)
+
+// checkUnattendedAuth returns an error unless the authentication works without
+// asking, which what, i.e. the command running on multiple SIMs, requires
+func checkUnattendedAuth(what string) error {
+	if identity == "" && len(identityPEM) == 0 && !agentOnly && password == "" {
+		return fmt.Errorf("%s cannot ask password, specify --identity, --identity-from-agent-only, or --password-file or SORACOM_SSH_PASSWORD environment variable", what)
+	}
+	return nil
+}
+
+// execOnSIMs runs execCommand on the SIMs concurrently up to --parallel, and
+// prints their output prefixed with the SIM name, or after the SIM as a header
+// if there is only one SIM. Returns exit code to exit with, i.e. the highest
+// exit status of the command, 1 if failed to run it on any SIM, or 0 if
+// succeeded on all SIMs.
+func execOnSIMs(sims []models.SIM) int {
+	code, failed := 0, 0
+	for _, err := range runOnSIMs(sims) {
+		if c := exitCode(err); c != 0 {
+			code = max(code, c)
+			failed++
+		}
+	}
+	if failed > 0 {
+		emitter.Emit("exec_failed", map[string]any{"failed": failed, "total": len(sims)}, "→ failed on %d of %d subscribers", failed, len(sims))
+	}
+	return code
+}
+
+// runOnSIMs runs execCommand on the SIMs concurrently up to --parallel, and
+// prints their output as execOnSIMs. Returns the error for each SIM, which is
+// *ssh.ExitError if the command exits with non-zero status.
+func runOnSIMs(sims []models.SIM) []error {
+	var mu sync.Mutex // serializes output lines of the SIMs
+	errs := make([]error, len(sims))
+
+	var g errgroup.Group
+	g.SetLimit(parallel)
+	for i, sim := range sims {
+		g.Go(func() error {
+			prefix := fmt.Sprintf("[%s] ", simName(sim))
+			if len(sims) == 1 {
+				// show the name as a header instead, so that the output can be used as is
+				fmt.Printf("=== %s ===\n", sim)
+				prefix = ""
+			}
+			stdout := &prefixWriter{mu: &mu, w: os.Stdout, prefix: prefix}
+			stderr := &prefixWriter{mu: &mu, w: os.Stderr, prefix: prefix}
+
+			errs[i] = execOnSIM(sim, stdout, stderr)
+			stdout.flush()
+			stderr.flush()
+
+			var exitError *ssh.ExitError
+			if errs[i] != nil && !errors.As(errs[i], &exitError) {
+				stderr.printf("nssh: %v\n", errs[i])
+			}
+			return nil
+		})
+	}
+	_ = g.Wait()
+	return errs
+}
+
+// exitCode returns exit status of the command if err is *ssh.ExitError, 1 for
+// other errors, or 0 if err is nil
+func exitCode(err error) int {
+	var exitError *ssh.ExitError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exitError):
+		return exitError.ExitStatus()
+	default:
+		return 1
+	}
+}
+
+// simName returns the name of the SIM, or the ID if it has no name
+func simName(sim models.SIM) string {
+	if sim.Tags.Name == "" {
+		return sim.ID
+	}
+	return sim.Tags.Name
+}
+
+// execOnSIM ensures port mapping for the SIM, then runs execCommand on it
+func execOnSIM(sim models.SIM, stdout, stderr io.Writer) error {
+	portMapping, release, err := ensurePortMapping(sim, port)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	err = client.Run(login, identity, portMapping, execCommand, stdout, stderr, connectOptions())
+	return withConnectHint(login, err)
+}
+
+// A prefixWriter writes each line prefixed with prefix to w, holding mu so
+// that lines written by concurrent writers are not mixed
+type prefixWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		p.writeLine(p.buf[:i+1])
+		p.buf = p.buf[i+1:]
+	}
+}
+
+// flush writes the last line without newline, if any
+func (p *prefixWriter) flush() {
+	if len(p.buf) > 0 {
+		p.writeLine(append(p.buf, '\n'))
+		p.buf = nil
+	}
+}
+
+// printf writes formatted message as lines
+func (p *prefixWriter) printf(format string, args ...any) {
+	_, _ = fmt.Fprintf(p, format, args...)
+	p.flush()
+}
+
+func (p *prefixWriter) writeLine(line []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, _ = fmt.Fprintf(p.w, "%s%s", p.prefix, line)
+}
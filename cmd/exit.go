@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/0x6b/nssh"
+	"golang.org/x/crypto/ssh"
+	"net"
+	"net/http"
+	"os"
+)
+
+// Exit codes of nssh, for scripts to tell the cause of failure. run and exec
+// exit with the exit status of the remote command instead of ExitRemote.
+const (
+	ExitOK       = 0
+	ExitError    = 1 // other errors, e.g. failure of SORACOM API
+	ExitUsage    = 2 // invalid command line, e.g. unknown flag or wrong number of arguments
+	ExitAuth     = 3 // authentication with SORACOM API or the SSH server of the device failed
+	ExitNotFound = 4 // the subscriber is not found, or offline
+	ExitMapping  = 5 // failed to find or create port mapping
+	ExitConnect  = 6 // failed to reach the SSH server of the device, or the connection was lost
+	ExitRemote   = 7 // the remote shell exited with non-zero status
+)
+
+// exitCodesHelp is the table of exit codes shown in help
+const exitCodesHelp = `Exit codes:
+  0  success
+  1  other errors, e.g. failure of SORACOM API
+  2  invalid command line, e.g. unknown flag or wrong number of arguments
+  3  authentication with SORACOM API or the SSH server of the device failed
+  4  the subscriber is not found, or offline
+  5  failed to find or create port mapping
+  6  failed to reach the SSH server of the device, or the connection was lost
+  7  the remote shell exited with non-zero status. run and exec exit with the
+     exit status of the remote command instead`
+
+// A codedError is err which nssh exits with code for, when the cause is not
+// told by err itself, e.g. errors of SORACOM API while creating port mapping
+type codedError struct {
+	err  error
+	code int
+}
+
+func (e codedError) Error() string {
+	return e.err.Error()
+}
+
+func (e codedError) Unwrap() error {
+	return e.err
+}
+
+// withExitCode returns err which nssh exits with code for, or nil if err is
+// nil
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return codedError{err: err, code: code}
+}
+
+// usageErrorf returns an error for invalid command line, e.g. conflicting
+// flags, which nssh exits with ExitUsage for. The message is prefixed with
+// "nssh: " as the other errors printed by the commands.
+func usageErrorf(format string, args ...any) error {
+	return withExitCode(ExitUsage, fmt.Errorf("nssh: "+format, args...))
+}
+
+// exitCodeOf returns the exit code for err
+func exitCodeOf(err error) int {
+	var coded codedError
+	var exitError *ssh.ExitError
+	var apiError *nssh.APIError
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.As(err, &coded):
+		return coded.code
+	case errors.As(err, &exitError):
+		return ExitRemote
+	case errors.Is(err, nssh.ErrAuthFailed),
+		errors.As(err, &apiError) && (apiError.StatusCode == http.StatusUnauthorized || apiError.StatusCode == http.StatusForbidden):
+		return ExitAuth
+	case errors.Is(err, nssh.ErrSIMNotFound), errors.Is(err, nssh.ErrSIMOffline):
+		return ExitNotFound
+	case errors.Is(err, nssh.ErrConnectionLost), unreachable(err):
+		return ExitConnect
+	default:
+		return ExitError
+	}
+}
+
+// unreachable returns true if err tells the SSH server of the device could not
+// be reached, e.g. wrong port or expired port mapping, or the tunnel of exec
+// --control could not be connected. Other errors, e.g. EOF while reading
+// response of SORACOM API, are not.
+func unreachable(err error) bool {
+	var opError *net.OpError
+	return errors.Is(err, nssh.ErrUnreachable) ||
+		errors.As(err, &opError) && opError.Op == "dial"
+}
+
+// exitWithError prints err, and exits with the exit code for it
+func exitWithError(err error) {
+	fmt.Println(err)
+	os.Exit(exitCodeOf(err))
+}
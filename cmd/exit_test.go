@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/0x6b/nssh"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestExitCodeOf(t *testing.T) {
+	var decoded map[string]any
+	decodeErr := json.NewDecoder(strings.NewReader("")).Decode(&decoded)
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "nil", err: nil, want: ExitOK},
+		{name: "other", err: errors.New("failed"), want: ExitError},
+		{name: "coded", err: withExitCode(ExitMapping, errors.New("failed to create port mapping")), want: ExitMapping},
+		{name: "usage", err: usageErrorf("cannot specify both %s and %s", "--eval", "--print-endpoint"), want: ExitUsage},
+		{name: "remote", err: fmt.Errorf("run: %w", &ssh.ExitError{}), want: ExitRemote},
+		{name: "SSH authentication", err: fmt.Errorf("%w as pi", nssh.ErrAuthFailed), want: ExitAuth},
+		{name: "SORACOM API authentication", err: &nssh.APIError{StatusCode: http.StatusUnauthorized}, want: ExitAuth},
+		{name: "SORACOM API failure", err: &nssh.APIError{StatusCode: http.StatusInternalServerError}, want: ExitError},
+		{name: "not found", err: fmt.Errorf("%w: gateway", nssh.ErrSIMNotFound), want: ExitNotFound},
+		{name: "offline", err: nssh.ErrSIMOffline, want: ExitNotFound},
+		{name: "connection lost", err: nssh.ErrConnectionLost, want: ExitConnect},
+		{name: "unreachable", err: fmt.Errorf("%w: %w", nssh.ErrUnreachable, io.EOF), want: ExitConnect},
+		{name: "dial", err: &net.OpError{Op: "dial", Net: "unix", Err: errors.New("no such file or directory")}, want: ExitConnect},
+		{name: "EOF", err: io.EOF, want: ExitError},
+		{name: "EOF decoding JSON", err: fmt.Errorf("failed to decode response: %w", decodeErr), want: ExitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCodeOf(tt.err); got != tt.want {
+				t.Errorf("exitCodeOf(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
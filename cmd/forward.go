@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/0x6b/nssh"
+	"github.com/spf13/cobra"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func forwardCmd() *cobra.Command {
+	forwardCmd := &cobra.Command{
+		Use:   "forward [<user>@][name:|imsi:|sim:]<subscriber name> -L [bind_address:]port:host:hostport",
+		Short: "Forward local ports to specified subscriber without opening a shell.",
+		Long:  "Connect to specified subscriber via SSH, and forward connections to the local ports to the addresses seen from the device, like `ssh -N -L` of OpenSSH, until interrupted, e.g. to open the web UI of the device in a browser. No shell is opened, so that it can run in background.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			stopWatching := tracker.watchSignals()
+
+			if err := nssh.ValidatePortMapping(port, duration); err != nil {
+				exitWithError(usageErrorf("%w", err))
+			}
+			if len(localForwards) == 0 {
+				exitWithError(usageErrorf("specify at least one local forward with -L"))
+			}
+			if err := parseLocalForwards(); err != nil {
+				exitWithError(usageErrorf("%w", err))
+			}
+
+			user, loginSpecified, target := loginOf(cmd.Flags(), args[0])
+			login = user
+			selector, value := parseSelector(target)
+			sim, err := findOnlineSIM(selector, value)
+			if err != nil {
+				exitWithError(err)
+			}
+			if sim == nil {
+				return
+			}
+			login = applySSHConfig(cmd.Flags(), *sim, login, loginSpecified)
+
+			portMapping, release, err := ensurePortMapping(*sim, port)
+			if err != nil {
+				exitWithError(err)
+			}
+			defer release()
+
+			sshClient, err := client.Dial(login, identity, portMapping, connectOptions())
+			if err != nil {
+				release()
+				exitWithError(withConnectHint(login, err))
+			}
+			defer sshClient.Close()
+
+			listeners, err := client.Forward(sshClient, forwards)
+			if err != nil {
+				release()
+				fmt.Printf("nssh: %v\n", err)
+				os.Exit(1)
+			}
+			defer listeners.Close()
+
+			// stop on the signals by ourselves, to delete the port mapping
+			stopWatching()
+			ch := make(chan os.Signal, 1)
+			signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+			defer signal.Stop(ch)
+			closed := make(chan error, 1)
+			go func() {
+				closed <- sshClient.Wait()
+			}()
+
+			emitter.Emit("forward_ready", map[string]any{"simId": sim.ID}, "→ press Ctrl+C to stop forwarding")
+			select {
+			case <-ch:
+			case err := <-closed:
+				emitter.Emit("forward_closed", map[string]any{"simId": sim.ID, "error": err}, "→ the connection is closed: %v", err)
+				release()
+				os.Exit(ExitConnect)
+			}
+		},
+	}
+
+	forwardCmd.Flags().StringVarP(&login, "login", "u", defaultLogin(), "Specify login user name. SORACOM_DEFAULT_USER environment variable is the default if set")
+	addLocalForwardFlag(forwardCmd)
+	addConnectFlags(forwardCmd)
+	return forwardCmd
+}
+
+// addLocalForwardFlag adds -L to forward local ports through the connection
+func addLocalForwardFlag(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVarP(&localForwards, "local-forward", "L", nil, "Forward connections to the local port to host:hostport seen from the device, i.e. [bind_address:]port:host:hostport like -L of OpenSSH, e.g. 8080:localhost:80. Can be repeated. localhost is listened on if bind_address is omitted, and all interfaces if it is *")
+}
+
+// parseLocalForwards parses the specs of -L into forwards
+func parseLocalForwards() error {
+	for _, spec := range localForwards {
+		f, err := nssh.ParseLocalForward(spec)
+		if err != nil {
+			return err
+		}
+		forwards = append(forwards, f)
+	}
+	return nil
+}
@@ -2,58 +2,20 @@ package cmd
 
 import (
 	"fmt"
+	"github.com/0x6b/nssh"
 	"github.com/0x6b/nssh/models"
-	"github.com/charmbracelet/bubbles/list"
-	"github.com/charmbracelet/bubbletea"
-	"github.com/charmbracelet/lipgloss"
 	"github.com/spf13/cobra"
 	"os"
 	"strings"
 )
 
-var docStyle = lipgloss.NewStyle().Margin(1, 2)
-
-type model struct {
-	list   list.Model
-	choice *models.SIM
-}
-
-func (m model) Init() tea.Cmd {
-	return nil
-}
-
-func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
-	switch msg := msg.(type) {
-	case tea.KeyMsg:
-		switch pressed := msg.String(); pressed {
-		case "q", "esc", "ctrl+c":
-			return m, tea.Quit
-		case "enter":
-			s, ok := m.list.SelectedItem().(models.SIM)
-			if ok {
-				m.choice = &s
-			}
-			return m, tea.Quit
-		}
-	case tea.WindowSizeMsg:
-		h, v := docStyle.GetFrameSize()
-		m.list.SetSize(msg.Width-h, msg.Height-v)
-	}
-
-	var cmd tea.Cmd
-	m.list, cmd = m.list.Update(msg)
-	return m, cmd
-}
-
-func (m model) View() string {
-	return docStyle.Render(m.list.View())
-}
-
-func (m model) Choice() *models.SIM {
-	return m.choice
-}
-
-var login string
+var (
+	login       string
+	filterPlan  string
+	filterSpeed string
+	filterName  string
+	incomplete  bool
+)
 
 func interactiveCmd() *cobra.Command {
 	interactiveCmd := &cobra.Command{
@@ -61,70 +23,109 @@ func interactiveCmd() *cobra.Command {
 		Aliases: []string{"i"},
 		Short:   "List online SIMs and select one of them to connect, interactively.",
 		Run: func(cmd *cobra.Command, args []string) {
+			defer tracker.watchSignals()()
+
+			if err := nssh.ValidatePortMapping(port, duration); err != nil {
+				exitWithError(usageErrorf("%w", err))
+			}
+
+			if execCommand != "" {
+				if err := checkUnattendedAuth("--exec"); err != nil {
+					exitWithError(usageErrorf("%w", err))
+				}
+				if jump != "" || dryRun {
+					exitWithError(usageErrorf("cannot specify --jump or --dry-run with --exec"))
+				}
+				if parallel < 1 {
+					exitWithError(usageErrorf("--parallel must be 1 or more"))
+				}
+			}
+
+			if simID != "" {
+				sim, err := getOnlineSIM(simID)
+				if err == nil && execCommand != "" {
+					os.Exit(execOnSIMs([]models.SIM{*sim}))
+				}
+				if err == nil {
+					err = connectToSIM(applySSHConfig(cmd.Flags(), *sim, login, cmd.Flags().Changed("login")), *sim)
+				}
+				if err != nil {
+					exitWithError(err)
+				}
+				return
+			}
+
 			sims, err := client.FindOnlineSIMs()
 			if err != nil {
-				fmt.Println(err)
-				os.Exit(1)
+				exitWithError(err)
 			}
 
-			items := make([]list.Item, 0)
+			if len(sims) == 0 {
+				fmt.Println("nssh: no online subscribers found")
+				return
+			}
 
+			var items []models.SIM
 			for _, s := range sims {
-				if s.ID != "" && s.ActiveSubscription() != "" && s.SpeedClass != "" {
+				if (incomplete || isComplete(s)) && matchFilters(s) {
 					items = append(items, s)
 				}
 			}
-
-			delegate := list.NewDefaultDelegate()
-			delegate.Styles.SelectedDesc.Foreground(lipgloss.Color("#34cdd7")).Faint(true)
-			delegate.Styles.SelectedTitle.Foreground(lipgloss.Color("#34cdd7"))
-			delegate.Styles.FilterMatch.Foreground(lipgloss.Color("#34cdd7"))
-
-			m := model{
-				list: list.New(items, delegate, 0, 0),
+			if len(items) == 0 {
+				fmt.Printf("nssh: none of %d online subscribers match the filters, or they lack ID, subscription or speed class. Specify --include-incomplete to show the latter\n", len(sims))
+				return
 			}
-			m.list.Title = "Online Subscribers"
-			m.list.Styles.Title = lipgloss.NewStyle().Background(lipgloss.Color("#34cdd7")).Foreground(lipgloss.Color("0")).Bold(true)
 
-			p := tea.NewProgram(m, tea.WithAltScreen())
+			if execCommand != "" {
+				selected, err := selectSIMs("Online Subscribers", items)
+				if err != nil {
+					exitWithError(err)
+				}
+				if len(selected) > 0 {
+					os.Exit(execOnSIMs(selected))
+				}
+				return
+			}
 
-			result, err := p.Run()
+			sim, err := selectSIM("Online Subscribers", items)
 			if err != nil {
-				fmt.Println("could not start program:", err)
-				os.Exit(1)
+				exitWithError(err)
 			}
 
-			if sim := result.(model).Choice(); sim != nil {
-				fmt.Printf("nssh: search existing port mappings for %s:%d\n", sim.ID, port)
-				var portMapping *models.PortMapping
-
-				available, err := client.FindAvailablePortMappingsForSIM(*sim, port)
-				if err != nil || len(available) == 0 {
-					fmt.Printf("nssh: → no existing port mapping for %s:%d, creating\n", sim.ID, port)
-					portMapping, err = client.CreatePortMappingForSIM(*sim, port, duration)
-					if err != nil {
-						fmt.Println(err)
-						os.Exit(1)
-					}
-				} else {
-					portMapping = &available[0]
-					fmt.Printf("nssh: → found available port mapping:\n%s\n", portMapping)
-				}
-
-				fmt.Printf("nssh: connect to %s@%s:%d using the port mapping\n", login, sim.ID, port)
-				fmt.Println(strings.Repeat("-", 40))
-				err = client.Connect(login, identity, portMapping)
+			if sim != nil {
+				err = connectToSIM(applySSHConfig(cmd.Flags(), *sim, login, cmd.Flags().Changed("login")), *sim)
 				if err != nil {
-					fmt.Println(err)
-					os.Exit(1)
+					exitWithError(err)
 				}
 			}
 		},
 	}
 
-	interactiveCmd.Flags().StringVarP(&login, "login", "u", "pi", "Specify login user name")
-	interactiveCmd.Flags().StringVarP(&identity, "identity", "i", "", "Specify a path to file from which the identity for public key authentication is read")
-	interactiveCmd.Flags().IntVarP(&port, "port", "p", 22, "Specify port number to connect")
-	interactiveCmd.Flags().IntVarP(&duration, "duration", "d", 60, "Specify session duration in minutes")
+	interactiveCmd.Flags().StringVarP(&login, "login", "u", defaultLogin(), "Specify login user name. SORACOM_DEFAULT_USER environment variable is the default if set")
+	interactiveCmd.Flags().StringVar(&simID, "sim-id", "", "Specify SIM ID to connect to, without showing the list")
+	interactiveCmd.Flags().StringVar(&term, "term", "", "Specify terminal type of the remote PTY. TERM environment variable, then xterm is used if not specified")
+	interactiveCmd.Flags().StringVar(&jump, "jump", "", "Connect via specified subscriber as a jump host, i.e. [<user>@]<subscriber name>. Port mappings for the destination permit the jump host. The jump host is connected on port 22")
+	interactiveCmd.Flags().StringVar(&filterPlan, "filter-plan", "", "Show only SIMs with specified subscription, e.g. plan01s")
+	interactiveCmd.Flags().StringVar(&filterSpeed, "filter-speed", "", "Show only SIMs with specified speed class, e.g. s1.4xfast")
+	interactiveCmd.Flags().StringVar(&filterName, "filter-name", "", "Show only SIMs whose name contains specified string")
+	interactiveCmd.Flags().BoolVar(&incomplete, "include-incomplete", false, "Show also SIMs without ID, subscription or speed class, which are hidden by default")
+	interactiveCmd.Flags().StringVar(&execCommand, "exec", "", "Run specified command on the selected SIM instead of opening a shell, and exit with its status. Select multiple SIMs with space to run it on each of them concurrently, with output prefixed with the subscriber name, and exit with the highest status")
+	interactiveCmd.Flags().IntVar(&parallel, "parallel", 4, "Specify maximum number of SIMs to run the command on concurrently with --exec")
+	interactiveCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show whether an existing port mapping is reused or new one is created, without creating port mapping nor connecting")
+	addConnectFlags(interactiveCmd)
 	return interactiveCmd
 }
+
+// isComplete reports whether the SIM has ID, subscription and speed class,
+// which are shown in the list
+func isComplete(s models.SIM) bool {
+	return s.ID != "" && s.ActiveSubscription() != "" && s.SpeedClass != ""
+}
+
+// matchFilters reports whether the SIM matches --filter-plan, --filter-speed
+// and --filter-name
+func matchFilters(s models.SIM) bool {
+	return (filterPlan == "" || s.ActiveSubscription() == filterPlan) &&
+		(filterSpeed == "" || s.SpeedClass == filterSpeed) &&
+		(filterName == "" || strings.Contains(s.Tags.Name, filterName))
+}
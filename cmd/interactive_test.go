@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"encoding/json"
+	"github.com/0x6b/nssh/models"
+	"testing"
+)
+
+func TestMatchFilters(t *testing.T) {
+	var sims []models.SIM
+	if err := json.Unmarshal([]byte(`[
+		{"simId": "1", "activeProfileId": "1", "speedClass": "s1.fast", "tags": {"name": "gateway-1"},
+		 "profiles": {"1": {"primaryImsi": "440100000000001", "subscribers": {"440100000000001": {"subscription": "plan01s"}}}}},
+		{"simId": "2", "activeProfileId": "2", "speedClass": "s1.slow", "tags": {"name": "sensor-1"},
+		 "profiles": {"2": {"primaryImsi": "440100000000002", "subscribers": {"440100000000002": {"subscription": "plan-D"}}}}},
+		{"simId": "3", "activeProfileId": "missing", "speedClass": "s1.fast", "tags": {"name": "gateway-2"}}
+	]`), &sims); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name                      string
+		plan, speed, filterByName string
+		want                      []bool
+	}{
+		{name: "none", want: []bool{true, true, true}},
+		{name: "plan", plan: "plan01s", want: []bool{true, false, false}},
+		{name: "speed", speed: "s1.fast", want: []bool{true, false, true}},
+		{name: "name", filterByName: "gateway", want: []bool{true, false, true}},
+		{name: "all", plan: "plan-D", speed: "s1.slow", filterByName: "sensor", want: []bool{false, true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filterPlan, filterSpeed, filterName = tt.plan, tt.speed, tt.filterByName
+			t.Cleanup(func() { filterPlan, filterSpeed, filterName = "", "", "" })
+			for i, s := range sims {
+				if got := matchFilters(s); got != tt.want[i] {
+					t.Errorf("matchFilters(%s) = %v, want %v", s.Tags.Name, got, tt.want[i])
+				}
+			}
+		})
+	}
+
+	// the SIM whose active profile is missing is not complete, rather than panicking
+	if isComplete(sims[2]) {
+		t.Error("isComplete() of the SIM without active profile = true")
+	}
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"context"
+	"golang.org/x/crypto/ssh"
+	"net"
+	"net/http"
+)
+
+// port of the jump host to connect via SSH
+const jumpPort = 22
+
+// dialJumpHost connects to the subscriber specified with --jump via SSH, in the
+// same manner as connectToSIM. Returned function releases the port mapping for
+// the jump host, and may be non-nil even if an error is returned.
+func dialJumpHost() (*ssh.Client, func(), error) {
+	jumpLogin, selector, value := parseArg(jump)
+	jumpSIM, err := findOnlineSIM(selector, value)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	portMapping, release, err := ensurePortMapping(*jumpSIM, jumpPort)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	emitter.Emit("connecting", map[string]any{"login": jumpLogin, "simId": jumpSIM.ID, "port": jumpPort, "endpoint": portMapping.Endpoint, "jump": true}, "connect to jump host %s@%s:%d using the port mapping", jumpLogin, jumpSIM.ID, jumpPort)
+	jumpClient, err := client.Dial(jumpLogin, identity, portMapping, connectOptions())
+	if err != nil {
+		return nil, release, err
+	}
+	return jumpClient, release, nil
+}
+
+// checkIPVia makes the client determine the global IP address through the
+// jump host, so that port mappings for the destination permit the jump host
+// instead of this machine. Returned function restores the original client to
+// determine the address.
+func checkIPVia(jumpClient *ssh.Client) func() {
+	checkIP := client.IPChecker()
+	original := *checkIP
+	checkIP.Client = &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return jumpClient.Dial(network, addr)
+			},
+		},
+	}
+	return func() {
+		*checkIP = original
+	}
+}
@@ -1,11 +1,27 @@
 package cmd
 
 import (
+	"cmp"
 	"fmt"
+	"github.com/0x6b/nssh/models"
 	"github.com/spf13/cobra"
-	"os"
+	"golang.org/x/sync/errgroup"
 )
 
+// maximum number of concurrent SIM lookups
+const lookupConcurrency = 8
+
+var (
+	count bool
+	quiet bool
+)
+
+// A listEntry represents a SIM and its port mappings to list
+type listEntry struct {
+	sim          *models.SIM
+	portMappings []models.PortMapping
+}
+
 func listCmd() *cobra.Command {
 	listCmd := &cobra.Command{
 		Use:     "list [subscriber name]",
@@ -13,50 +29,153 @@ func listCmd() *cobra.Command {
 		Short:   "List port mappings for specified subscriber. If no subscriber name is specified, list all port mappings.",
 		Args:    cobra.RangeArgs(0, 1),
 		Run: func(cmd *cobra.Command, args []string) {
+			if count && quiet {
+				exitWithError(usageErrorf("cannot specify both --count and --quiet"))
+			}
+
+			var err error
 			if len(args) == 0 {
-				portMappings, err := client.ListPortMappings()
-				if err != nil {
-					fmt.Println(err)
-					os.Exit(1)
-				}
-
-				for _, pm := range portMappings {
-					sim, err := client.GetSIM(pm.Destination.ID)
-					if err != nil {
-						fmt.Println(err)
-						os.Exit(1)
-					}
-					fmt.Println(sim)
-					fmt.Println(pm)
-				}
-				return
-			}
-
-			sims, err := client.FindSIMsByName(args[0])
+				err = listAllPortMappings()
+			} else {
+				err = printPortMappingsByName(args[0])
+			}
 			if err != nil {
-				fmt.Println(err)
-				os.Exit(1)
-			}
-
-			for _, s := range sims {
-				portMappings, err := client.FindPortMappingsForSIM(s)
-				if err != nil {
-					fmt.Println(err)
-					os.Exit(1)
-				}
-
-				if len(portMappings) > 0 {
-					fmt.Println(s)
-					for i, pm := range portMappings {
-						fmt.Printf("#%d:\n", i+1)
-						fmt.Println(pm)
-					}
-				} else {
-					fmt.Printf("no port mapping for %s\n", s)
-				}
+				exitWithError(err)
 			}
 		},
 	}
 
+	listCmd.Flags().BoolVar(&count, "count", false, "Print only the number of port mappings")
+	listCmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Print only the endpoints of port mappings, one per line, without progress messages")
 	return listCmd
 }
+
+// listAllPortMappings prints port mappings as they are listed, so that the
+// output starts before all pages are fetched. Destination SIMs are looked up
+// concurrently for every lookupConcurrency port mappings unless only the count
+// or endpoints are printed, and the first error of the lookups is returned
+// after all port mappings are printed.
+func listAllPortMappings() error {
+	n := 0
+	var batch []models.PortMapping
+	var lookupErr error
+	flush := func() {
+		sims, err := getSIMsForPortMappings(batch)
+		for i, sim := range sims {
+			if sim == nil {
+				continue
+			}
+			fmt.Println(sim)
+			fmt.Println(batch[i])
+			fmt.Printf("- Reconnect: nssh ssh %s\n", batch[i].SSHTarget())
+		}
+		lookupErr = cmp.Or(lookupErr, err)
+		batch = batch[:0]
+	}
+
+	err := client.ListPortMappingsFunc(func(pm models.PortMapping) error {
+		switch {
+		case count:
+			n++
+		case quiet:
+			fmt.Println(pm.Endpoint)
+		default:
+			if batch = append(batch, pm); len(batch) == lookupConcurrency {
+				flush()
+			}
+		}
+		return nil
+	})
+	if len(batch) > 0 {
+		flush()
+	}
+	if err != nil {
+		return err
+	}
+
+	if count {
+		fmt.Println(n)
+	}
+	return lookupErr
+}
+
+// printPortMappingsByName prints port mappings of each SIM with the name, or
+// that it has none
+func printPortMappingsByName(name string) error {
+	entries, err := listPortMappingsByName(name)
+
+	switch {
+	case count:
+		n := 0
+		for _, e := range entries {
+			n += len(e.portMappings)
+		}
+		fmt.Println(n)
+	case quiet:
+		for _, e := range entries {
+			for _, pm := range e.portMappings {
+				fmt.Println(pm.Endpoint)
+			}
+		}
+	default:
+		for _, e := range entries {
+			if len(e.portMappings) == 0 {
+				fmt.Printf("no port mapping for %s\n", e.sim)
+				continue
+			}
+			fmt.Println(e.sim)
+			for i, pm := range e.portMappings {
+				fmt.Printf("#%d:\n", i+1)
+				fmt.Println(pm)
+				fmt.Printf("- Reconnect: nssh ssh %s\n", pm.SSHTarget())
+			}
+		}
+	}
+	return err
+}
+
+// listPortMappingsByName returns an entry for each SIM whose name contains
+// name, as the query API matches it partially, which may have no port
+// mappings. Returns an error exiting with ExitNotFound if no SIM has the name,
+// as the other commands looking up subscribers.
+func listPortMappingsByName(name string) ([]listEntry, error) {
+	sims, err := client.FindSIMsByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(sims) == 0 {
+		return nil, withExitCode(ExitNotFound, fmt.Errorf("nssh: no subscribers named \"%s\"", name))
+	}
+
+	var entries []listEntry
+	for _, s := range sims {
+		portMappings, err := client.FindPortMappingsForSIM(s)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, listEntry{sim: &s, portMappings: portMappings})
+	}
+	return entries, nil
+}
+
+// getSIMsForPortMappings gets destination SIMs of the port mappings
+// concurrently. The i-th SIM is for the i-th port mapping, or nil if failed to
+// get. Returns the first error after all lookups finish.
+func getSIMsForPortMappings(portMappings []models.PortMapping) ([]*models.SIM, error) {
+	sims := make([]*models.SIM, len(portMappings))
+
+	var g errgroup.Group
+	g.SetLimit(lookupConcurrency)
+	for i, pm := range portMappings {
+		g.Go(func() error {
+			sim, err := client.GetSIM(pm.Destination.ID)
+			if err != nil {
+				return err
+			}
+			sims[i] = sim
+			return nil
+		})
+	}
+
+	return sims, g.Wait()
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"encoding/json"
+	"github.com/0x6b/nssh"
+	"testing"
+)
+
+func TestListPortMappingsByName(t *testing.T) {
+	var data nssh.MockData
+	if err := json.Unmarshal([]byte(`{
+		"sims": [
+			{"simId": "8981100000000000001", "activeProfileId": "8981100000000000001", "tags": {"name": "gateway"},
+			 "profiles": {"8981100000000000001": {"primaryImsi": "440100000000001", "subscribers": {"440100000000001": {"imsi": "440100000000001", "subscription": "plan01s"}}}}},
+			{"simId": "8981100000000000002", "tags": {"name": "gateway-2"}}
+		],
+		"portMappings": [{"endpoint": "192.0.2.10:10000", "destination": {"simId": "8981100000000000001", "port": 22}}]
+	}`), &data); err != nil {
+		t.Fatal(err)
+	}
+	c, err := nssh.NewMockSoracomClient(&data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = c
+	t.Cleanup(func() { client = nil })
+
+	entries, err := listPortMappingsByName("gateway")
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("listPortMappingsByName() = %v, %v, want both SIMs whose name contains gateway", entries, err)
+	}
+	if e := entries[0]; e.sim.ID != "8981100000000000001" || len(e.portMappings) != 1 || e.portMappings[0].Endpoint != "192.0.2.10:10000" {
+		t.Errorf("listPortMappingsByName() = %+v", e)
+	}
+	if e := entries[1]; e.sim.ID != "8981100000000000002" || len(e.portMappings) != 0 {
+		t.Errorf("listPortMappingsByName() = %+v, want the SIM without port mappings", e)
+	}
+
+	// the name is matched partially, as the query API does
+	entries, err = listPortMappingsByName("gate")
+	if err != nil || len(entries) != 2 {
+		t.Errorf("listPortMappingsByName() of partial name = %v, %v, want both SIMs", entries, err)
+	}
+
+	if _, err := listPortMappingsByName("sensor"); exitCodeOf(err) != ExitNotFound {
+		t.Errorf("listPortMappingsByName() of unknown name = %v, want ExitNotFound", err)
+	}
+}
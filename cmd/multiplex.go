@@ -0,0 +1,441 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/0x6b/nssh"
+	"github.com/0x6b/nssh/models"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// maximum number of lines kept for each pane
+const scrollback = 1000
+
+var (
+	paneStyle        = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("240"))
+	focusedPaneStyle = paneStyle.BorderForeground(lipgloss.Color("#34cdd7"))
+	paneTitleStyle   = lipgloss.NewStyle().Bold(true)
+	helpStyle        = lipgloss.NewStyle().Foreground(lipgloss.Color("241"))
+
+	// escape sequences which cannot be rendered in a pane, e.g. colors and cursor movements
+	escapeSequence = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+)
+
+// A pane represents a shell on a SIM shown in the multiplex view
+type pane struct {
+	title   string
+	client  *ssh.Client
+	session *ssh.Session
+	stdin   io.WriteCloser
+	lines   []string
+	current string
+	closed  bool
+	release func() // releases the port mapping created for the pane
+}
+
+// write appends output of the shell to the pane
+func (p *pane) write(s string) {
+	s = escapeSequence.ReplaceAllString(s, "")
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\t", "    ")
+
+	for _, r := range s {
+		switch r {
+		case '\n':
+			p.lines = append(p.lines, p.current)
+			p.current = ""
+		case '\r':
+			p.current = ""
+		case '\b':
+			if rs := []rune(p.current); len(rs) > 0 {
+				p.current = string(rs[:len(rs)-1])
+			}
+		case '\a':
+			// ignore bell
+		default:
+			p.current += string(r)
+		}
+	}
+
+	if len(p.lines) > scrollback {
+		p.lines = p.lines[len(p.lines)-scrollback:]
+	}
+}
+
+// close closes the session and the connection of the pane
+func (p *pane) close() {
+	p.closed = true
+	_ = p.session.Close()
+	_ = p.client.Close()
+}
+
+// view renders last lines of the pane which fit into specified size
+func (p *pane) view(width, height int) string {
+	lines := append(append([]string{}, p.lines...), p.current)
+	if height < len(lines) {
+		lines = lines[len(lines)-height:]
+	}
+
+	truncate := lipgloss.NewStyle().MaxWidth(width)
+	for i, l := range lines {
+		lines[i] = truncate.Render(l)
+	}
+	return strings.Join(lines, "\n")
+}
+
+type paneOutputMsg struct {
+	pane *pane
+	data string
+}
+
+type paneClosedMsg struct {
+	pane *pane
+	err  error
+}
+
+type multiplexModel struct {
+	panes  []*pane
+	focus  int
+	input  textinput.Model
+	width  int
+	height int
+}
+
+func (m multiplexModel) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+func (m multiplexModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+q":
+			for _, p := range m.panes {
+				p.close()
+			}
+			return m, tea.Quit
+		case "tab":
+			m.focus = (m.focus + 1) % len(m.panes)
+			m.input.Prompt = m.panes[m.focus].title + "> "
+			return m, nil
+		case "shift+tab":
+			m.focus = (m.focus + len(m.panes) - 1) % len(m.panes)
+			m.input.Prompt = m.panes[m.focus].title + "> "
+			return m, nil
+		case "ctrl+w":
+			p := m.panes[m.focus]
+			p.close()
+			m.panes = append(m.panes[:m.focus], m.panes[m.focus+1:]...)
+			if len(m.panes) == 0 {
+				return m, tea.Quit
+			}
+			m.focus = m.focus % len(m.panes)
+			m.input.Prompt = m.panes[m.focus].title + "> "
+			// delete the port mapping in background, not to block the other panes
+			return m, tea.Batch(m.resize(), releasePane(p))
+		case "enter":
+			m.send(m.input.Value() + "\n")
+			m.input.Reset()
+			return m, nil
+		case "ctrl+c":
+			m.send("\x03")
+			return m, nil
+		case "ctrl+d":
+			m.send("\x04")
+			return m, nil
+		}
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+		m.input.Width = msg.Width - len(m.input.Prompt) - 1
+		return m, m.resize()
+	case paneOutputMsg:
+		if m.contains(msg.pane) {
+			msg.pane.write(msg.data)
+		}
+		return m, nil
+	case paneClosedMsg:
+		if p := msg.pane; m.contains(p) && !p.closed {
+			p.write("\n")
+			if msg.err != nil {
+				p.write(fmt.Sprintf("[session closed: %v]\n", msg.err))
+			} else {
+				p.write("[session closed]\n")
+			}
+			p.closed = true
+		}
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+func (m multiplexModel) View() string {
+	if m.width == 0 || len(m.panes) == 0 {
+		return ""
+	}
+
+	cols, rows, w, h := m.layout()
+	var grid []string
+	for r := 0; r < rows; r++ {
+		var row []string
+		for c := 0; c < cols; c++ {
+			i := r*cols + c
+			if i >= len(m.panes) {
+				break
+			}
+			p := m.panes[i]
+			style := paneStyle
+			if i == m.focus {
+				style = focusedPaneStyle
+			}
+			title := p.title
+			if p.closed {
+				title += " (closed)"
+			}
+			content := paneTitleStyle.MaxWidth(w-2).Render(title) + "\n" + p.view(w-2, h-3)
+			row = append(row, style.Width(w-2).Height(h-2).Render(content))
+		}
+		grid = append(grid, lipgloss.JoinHorizontal(lipgloss.Top, row...))
+	}
+
+	help := helpStyle.Render("tab/shift+tab: switch pane • enter: send line • ctrl+c: send interrupt • ctrl+w: close pane • ctrl+q: quit")
+	return lipgloss.JoinVertical(lipgloss.Left, lipgloss.JoinVertical(lipgloss.Left, grid...), m.input.View(), help)
+}
+
+// layout returns number of columns and rows of the grid, and size of each pane
+func (m multiplexModel) layout() (int, int, int, int) {
+	cols := int(math.Ceil(math.Sqrt(float64(len(m.panes)))))
+	rows := int(math.Ceil(float64(len(m.panes)) / float64(cols)))
+	// leave two lines for the input and the help
+	return cols, rows, m.width / cols, (m.height - 2) / rows
+}
+
+// resize notifies new pane size to the shells
+func (m multiplexModel) resize() tea.Cmd {
+	if m.width == 0 || len(m.panes) == 0 {
+		return nil
+	}
+
+	_, _, w, h := m.layout()
+	// snapshot the sessions of open panes here, as the command runs in another
+	// goroutine while Update modifies the panes
+	var sessions []*ssh.Session
+	for _, p := range m.panes {
+		if !p.closed {
+			sessions = append(sessions, p.session)
+		}
+	}
+	return func() tea.Msg {
+		for _, s := range sessions {
+			_ = s.WindowChange(h-3, w-2)
+		}
+		return nil
+	}
+}
+
+// send writes s to stdin of the focused shell
+func (m multiplexModel) send(s string) {
+	if p := m.panes[m.focus]; !p.closed {
+		_, _ = io.WriteString(p.stdin, s)
+	}
+}
+
+// contains reports whether the pane is still shown, i.e. not closed by the user
+func (m multiplexModel) contains(p *pane) bool {
+	for _, q := range m.panes {
+		if p == q {
+			return true
+		}
+	}
+	return false
+}
+
+func multiplexCmd() *cobra.Command {
+	multiplexCmd := &cobra.Command{
+		Use:     "multiplex [<user>@][name:|imsi:|sim:]<subscriber name>...",
+		Aliases: []string{"m"},
+		Short:   "Connect to specified subscribers via SSH, and show their shells in split panes.",
+		Long:    "Create port mappings for specified subscribers and connect via SSH, then show their shells side by side. Input is sent to the focused pane. If <user>@ is not specified, SORACOM_DEFAULT_USER environment variable, or \"pi\" will be used as default. Quote with \" if name contains spaces or special characters.",
+		Args:    cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			defer tracker.watchSignals()()
+
+			if err := nssh.ValidatePortMapping(port, duration); err != nil {
+				exitWithError(usageErrorf("%w", err))
+			}
+
+			err := multiplex(args)
+			if err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+
+	addConnectFlags(multiplexCmd)
+	return multiplexCmd
+}
+
+// multiplex connects to the subscribers specified by args, and runs split
+// pane view of their shells until the user quits
+func multiplex(args []string) error {
+	var panes []*pane
+	defer func() {
+		for _, p := range panes {
+			p.close()
+		}
+	}()
+
+	var releases []func()
+	defer func() {
+		for _, release := range releases {
+			release()
+		}
+	}()
+
+	for _, arg := range args {
+		login, selector, value := parseArg(arg)
+		sim, err := findPaneSIM(selector, value)
+		if err != nil {
+			return err
+		}
+
+		p, release, err := openPane(login, *sim)
+		if release != nil {
+			releases = append(releases, release)
+		}
+		if err != nil {
+			return err
+		}
+		panes = append(panes, p)
+	}
+
+	input := textinput.New()
+	input.Prompt = panes[0].title + "> "
+	input.Focus()
+
+	m := multiplexModel{
+		panes: append([]*pane{}, panes...),
+		input: input,
+	}
+	program := tea.NewProgram(m, tea.WithAltScreen())
+
+	for _, p := range panes {
+		go forward(program, p)
+	}
+
+	if _, err := program.Run(); err != nil {
+		return fmt.Errorf("could not start program: %w", err)
+	}
+	return nil
+}
+
+// findPaneSIM finds the online SIM like findOnlineSIM, but does not let the
+// user select one of multiple SIMs with the name, as the multiplex view is
+// shown for all panes. --select-first still selects one of them.
+func findPaneSIM(selector, value string) (*models.SIM, error) {
+	if selector != selectByName {
+		return findOnlineSIM(selector, value)
+	}
+	return findOnlineSIMByName(value, false)
+}
+
+// openPane finds or creates a port mapping for the SIM, then starts a shell on
+// it. Returned function releases the port mapping, and may be non-nil even if
+// an error is returned.
+func openPane(login string, sim models.SIM) (*pane, func(), error) {
+	portMapping, release, err := ensurePortMapping(sim, port)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	emitter.Emit("connecting", map[string]any{"login": login, "simId": sim.ID, "port": port, "endpoint": portMapping.Endpoint}, "connect to %s@%s:%d using the port mapping", login, sim.ID, port)
+	c, err := client.Dial(login, identity, portMapping, connectOptions())
+	if err != nil {
+		return nil, release, err
+	}
+	emitter.Emit("connected", map[string]any{"login": login, "endpoint": portMapping.Endpoint}, "")
+
+	session, err := c.NewSession()
+	if err != nil {
+		_ = c.Close()
+		return nil, release, err
+	}
+
+	// the output is rendered as plain text, so ask the shell not to decorate it
+	err = session.RequestPty("dumb", 24, 80, ssh.TerminalModes{
+		ssh.ECHO:          0,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	})
+	if err != nil {
+		_ = c.Close()
+		return nil, release, err
+	}
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		_ = c.Close()
+		return nil, release, fmt.Errorf("failed to setup stdin for session: %v", err)
+	}
+
+	name := sim.Tags.Name
+	if name == "" {
+		name = sim.ID
+	}
+	return &pane{
+		title:   fmt.Sprintf("%s@%s", login, name),
+		client:  c,
+		session: session,
+		stdin:   stdin,
+		release: release,
+	}, release, nil
+}
+
+// releasePane returns the command to release the port mapping of the closed
+// pane, then redraw the screen as progress messages are written over it
+func releasePane(p *pane) tea.Cmd {
+	return func() tea.Msg {
+		p.release()
+		return tea.ClearScreen()
+	}
+}
+
+// forward starts the shell of the pane, and sends its output to the program
+// until the session ends
+func forward(program *tea.Program, p *pane) {
+	// stderr is merged into stdout by the remote PTY
+	stdout, err := p.session.StdoutPipe()
+	if err != nil {
+		program.Send(paneClosedMsg{pane: p, err: err})
+		return
+	}
+
+	if err := p.session.Shell(); err != nil {
+		program.Send(paneClosedMsg{pane: p, err: err})
+		return
+	}
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := stdout.Read(buf)
+		if n > 0 {
+			program.Send(paneOutputMsg{pane: p, data: string(buf[:n])})
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	err = p.session.Wait()
+	program.Send(paneClosedMsg{pane: p, err: err})
+}
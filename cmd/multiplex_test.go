@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"encoding/json"
+	"github.com/0x6b/nssh"
+	"io"
+	"testing"
+)
+
+func TestFindPaneSIM(t *testing.T) {
+	var data nssh.MockData
+	if err := json.Unmarshal([]byte(`{"sims": [
+		{"simId": "8981100000000000001", "tags": {"name": "gateway"}, "sessionStatus": {"online": true}},
+		{"simId": "8981100000000000003", "tags": {"name": "sensor"}, "sessionStatus": {"online": true}},
+		{"simId": "8981100000000000002", "tags": {"name": "sensor"}, "sessionStatus": {"online": true}},
+		{"simId": "8981100000000000004", "tags": {"name": "camera"}, "sessionStatus": {"online": false}}
+	]}`), &data); err != nil {
+		t.Fatal(err)
+	}
+	emitter = nssh.NewTextEmitter(io.Discard, "en")
+	c, err := nssh.NewMockSoracomClient(&data, nssh.WithEmitter(emitter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = c
+	t.Cleanup(func() { client, emitter = nil, nil })
+
+	tests := []struct {
+		name        string
+		value       string
+		selectFirst bool
+		want        string // SIM ID, or empty if an error is expected
+		code        int    // exit code of the error
+	}{
+		{name: "found", value: "gateway", want: "8981100000000000001"},
+		{name: "not found", value: "router", code: ExitNotFound},
+		{name: "offline", value: "camera", code: ExitNotFound},
+		{name: "ambiguous", value: "sensor", code: ExitError},
+		{name: "ambiguous with --select-first", value: "sensor", selectFirst: true, want: "8981100000000000002"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selectFirst = tt.selectFirst
+			t.Cleanup(func() { selectFirst = false })
+
+			sim, err := findPaneSIM(selectByName, tt.value)
+			if tt.want == "" {
+				if err == nil || exitCodeOf(err) != tt.code {
+					t.Errorf("findPaneSIM(%s) = %v, %v, want error exiting with %d", tt.value, sim, err, tt.code)
+				}
+				return
+			}
+			if err != nil || sim == nil || sim.ID != tt.want {
+				t.Errorf("findPaneSIM(%s) = %v, %v, want %s", tt.value, sim, err, tt.want)
+			}
+		})
+	}
+}
@@ -11,7 +11,7 @@ func main() {
 
 func run() int {
 	if err := cmd.RootCmd.Execute(); err != nil {
-		return -1
+		return cmd.ExitUsage
 	}
-	return 0
+	return cmd.ExitOK
 }
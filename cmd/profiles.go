@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/0x6b/nssh"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+var validate string
+
+func profilesCmd() *cobra.Command {
+	profilesCmd := &cobra.Command{
+		Use:   "profiles",
+		Short: "List SORACOM profiles in the profile directory, and check they are valid.",
+		Long:  "List SORACOM profiles in the profile directory ($HOME/.soracom, $XDG_CONFIG_HOME/soracom or $HOME/.config/soracom if exists on Linux, or SORACOM_PROFILE_DIR environment variable if set), and check they have required fields. With --validate, authenticate with the specified profile to confirm the credentials work.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if validate != "" {
+				options, err := clientOptions()
+				if err != nil {
+					exitWithError(err)
+				}
+
+				fmt.Printf("nssh: authenticate with profile \"%s\"\n", validate)
+				if _, err := nssh.NewSoracomClient(coverageType, validate, options...); err != nil {
+					fmt.Printf("nssh: → failed: %v\n", err)
+					os.Exit(1)
+				}
+				fmt.Println("nssh: → succeeded")
+				return
+			}
+
+			dir, err := nssh.ProfileDir()
+			if err != nil {
+				exitWithError(err)
+			}
+
+			names, err := nssh.ListProfiles()
+			if err != nil {
+				exitWithError(err)
+			}
+
+			if len(names) == 0 {
+				fmt.Printf("no profile found in %s\n", dir)
+				return
+			}
+
+			fmt.Printf("profiles in %s:\n", dir)
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			_, _ = fmt.Fprintln(w, "NAME\tCOVERAGE TYPE\tAUTH KEY ID\tSTATUS")
+			for _, name := range names {
+				p, err := nssh.LoadProfile(name)
+				if err != nil {
+					_, _ = fmt.Fprintf(w, "%s\t-\t-\t%v\n", name, err)
+					continue
+				}
+				_, _ = fmt.Fprintf(w, "%s\t%s\t%s\tok\n", name, p.CoverageType, mask(p.AuthKeyID))
+			}
+			_ = w.Flush()
+		},
+	}
+
+	profilesCmd.Flags().StringVar(&validate, "validate", "", "Specify profile name to authenticate with, to confirm the credentials work")
+	return profilesCmd
+}
+
+// mask masks s except its first few characters, e.g. keyId-abcd********
+func mask(s string) string {
+	const visible = 10
+	if len(s) <= visible {
+		return strings.Repeat("*", len(s))
+	}
+	return s[:visible] + strings.Repeat("*", 8)
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/0x6b/nssh"
+	"github.com/0x6b/nssh/models"
+	"github.com/spf13/cobra"
+)
+
+var deleteOld bool
+
+func renewCmd() *cobra.Command {
+	renewCmd := &cobra.Command{
+		Use:   "renew [name:|imsi:|sim:]<subscriber name>",
+		Short: "Create new port mapping for specified subscriber to replace the existing one.",
+		Long:  "Find the existing port mapping for specified subscriber and port, then create new one with specified duration, as a port mapping cannot be extended. With --sim-id, the subscriber name should be omitted.",
+		Args:  cobra.RangeArgs(0, 1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := nssh.ValidatePortMapping(port, duration); err != nil {
+				exitWithError(usageErrorf("%w", err))
+			}
+
+			var sim *models.SIM
+			var err error
+			switch {
+			case simID != "" && len(args) > 0:
+				exitWithError(usageErrorf("cannot specify both subscriber name and --sim-id"))
+			case simID != "":
+				sim, err = getOnlineSIM(simID)
+			case len(args) > 0:
+				sim, err = findOnlineSIM(parseSelector(args[0]))
+			default:
+				exitWithError(usageErrorf("specify subscriber name or --sim-id"))
+			}
+			if err != nil {
+				exitWithError(err)
+			}
+			if sim == nil {
+				return
+			}
+
+			err = renew(*sim)
+			if err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+
+	renewCmd.Flags().StringVar(&simID, "sim-id", "", "Specify SIM ID to renew the port mapping for, instead of subscriber name")
+	renewCmd.Flags().IntVarP(&port, "port", "p", 22, "Specify port number on the device, i.e. destination port of the port mapping, 1-65535")
+	duration = 60
+	renewCmd.Flags().VarP((*minutesValue)(&duration), "duration", "d", "Specify duration of new port mapping in minutes, or with unit such as 2h or 90m, 1m-8h")
+	renewCmd.Flags().StringSliceVar(&sourceCIDRs, "source-cidr", nil, "Specify source CIDR permitted to connect to new port mapping. Can be repeated. Current global IP address/32 is used if not specified")
+	renewCmd.Flags().StringVar(&sourceCIDRFile, "source-cidr-file", "", "Specify a path to file of source CIDRs, one per line with # for comments, e.g. a team allowlist. They are permitted in addition to --source-cidr and current global IP address")
+	renewCmd.Flags().BoolVar(&noAutoIP, "no-auto-ip", false, "Do not permit current global IP address in addition to --source-cidr-file")
+	renewCmd.Flags().BoolVar(&tlsRequired, "tls", false, "Renew the port mapping which requires TLS")
+	renewCmd.Flags().IntVar(&maxMappings, "max-mappings", 0, "Warn before creating port mapping if the number of port mappings of the account reaches this, 0 to disable")
+	renewCmd.Flags().BoolVar(&deleteOld, "delete-old", false, "Delete the existing port mapping after new one is created")
+	return renewCmd
+}
+
+// renew creates new port mapping for the SIM to replace existing one, and
+// deletes the existing one if --delete-old is specified
+func renew(sim models.SIM) error {
+	emitter.Emit("port_mappings_searching", map[string]any{"simId": sim.ID, "port": port}, "search existing port mappings for %s:%d", sim.ID, port)
+	portMappings, err := client.FindPortMappingsForSIM(sim)
+	if err != nil {
+		return err
+	}
+
+	var old []models.PortMapping
+	for _, pm := range portMappings {
+		if pm.Destination.Port == port && pm.TLSRequired == tlsRequired {
+			old = append(old, pm)
+		}
+	}
+	if len(old) == 0 {
+		return withExitCode(ExitMapping, fmt.Errorf("nssh: → no port mapping to renew for %s:%d, use connect to create new one", sim.ID, port))
+	}
+	emitter.Emit("port_mappings_found", map[string]any{"simId": sim.ID, "port": port, "count": len(old)}, "→ found %d port mapping(s) for %s:%d", len(old), sim.ID, port)
+
+	warnPortMappingLimit()
+	portMapping, err := client.CreatePortMappingForSIM(sim, port, duration, portMappingSourceCIDRs(), tlsRequired)
+	if err != nil {
+		return withExitCode(ExitMapping, withPortMappingLimitHint(err))
+	}
+	emitter.Emit("port_mapping_created", map[string]any{"simId": sim.ID, "endpoint": portMapping.Endpoint, "sourceCIDRs": portMapping.Source.IPRanges}, "→ created port mapping:\n%s", portMapping)
+
+	if !deleteOld {
+		return nil
+	}
+	for i := range old {
+		pm := &old[i]
+		if err := client.DeletePortMapping(pm); err != nil {
+			emitter.Emit("port_mapping_delete_failed", map[string]any{"endpoint": pm.Endpoint, "error": err}, "→ failed to delete port mapping %s: %v", pm.Endpoint, err)
+			continue
+		}
+		emitter.Emit("port_mapping_deleted", map[string]any{"endpoint": pm.Endpoint}, "→ deleted port mapping %s", pm.Endpoint)
+	}
+	return nil
+}
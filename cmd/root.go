@@ -4,42 +4,346 @@ import (
 	"fmt"
 	"github.com/0x6b/nssh"
 	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+	"io"
+	"log/slog"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var (
 	coverageType string
 	profileName  string
 	identity     string
+	simID        string
 	port         int
 	duration     int
-	client       *nssh.SoracomClient
+	cleanup      bool
+	sourceCIDRs  []string
+	tlsRequired  bool
+	tlsInsecure  bool
+	dryRun       bool
+	last         bool
+	proxy        string
+	caCert       string
+	tokenTimeout int
+	checkIPURL   string
+	endpoint     string
+	noCache      bool
+	verbose      int
+	simLimit     int
+	logFormat    string
+	lang         string
+	logger       *slog.Logger
+	emitter      *nssh.Emitter
+	client       nssh.API
+
+	serverAliveInterval int
+	serverAliveCountMax int
+	noExpiryWarning     bool
+	term                string
+	noPTY               bool
+	jump                string
+	reconnect           bool
+	maxReconnects       int
+	identityStdin       bool
+	identityPEM         []byte
+	passwordFile        string
+	password            string // from passwordFile or SORACOM_SSH_PASSWORD environment variable
+	hasLoginFlag        bool   // the command has -u, i.e. --login
+	certificate         string
+	showTimings         bool
+	timings             *nssh.Timings
+	fromList            bool
+	noProgress          bool
+	quietProgress       bool
+	traceFile           string
+	reuse               bool
+	sessionLog          string
+	sessionLogInput     bool
+	sessionLogWriter    *nssh.SessionLog
+	yes                 bool
+	compress            bool
+	sourceCIDRFile      string
+	noAutoIP            bool
+	printEndpoint       string
+	connectTimeout      int
+	evalOutput          bool
+	evalStdout          io.Writer // original stdout for --eval, as os.Stdout is replaced with stderr
+	ciphers             []string
+	macs                []string
+	keyExchanges        []string
+	proxyCommand        string
+	noTitle             bool
+	agentOnly           bool
+	mockFile            string
+	selectFirst         bool
+	localForwards       []string
+	forwards            []nssh.LocalForward // parsed from localForwards
 )
 
 var RootCmd = &cobra.Command{
 	Use:   "nssh name",
 	Short: "nssh -- SSH client for SORACOM Napter",
+	Long:  "nssh -- SSH client for SORACOM Napter\n\n" + exitCodesHelp,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		initConfig()
+		if coverageType != "" {
+			if _, err := nssh.NormalizeCoverageType(coverageType); err != nil {
+				exitWithError(usageErrorf("%w", err))
+			}
+		}
+		if compress {
+			exitWithError(usageErrorf("--compress is not supported, as golang.org/x/crypto/ssh does not implement SSH compression. Choose lighter algorithms with --cipher, --mac and --kex instead"))
+		}
+		initTokenTimeout()
+		if err := nssh.ValidateAlgorithms(ciphers, macs, keyExchanges); err != nil {
+			exitWithError(usageErrorf("%w", err))
+		}
+		initSourceCIDRs()
+		hasLoginFlag = cmd.Flags().Lookup("login") != nil
+		if showTimings {
+			timings = &nssh.Timings{}
+		}
+		if !noClientCommands[cmd.Name()] {
+			initIdentity()
+			initPassword()
+			initClient()
+		}
+	},
 }
 
-func init() {
-	RootCmd.PersistentFlags().StringVar(&coverageType, "coverage-type", "", "Specify coverage type, \"g\" for Global, \"jp\" for Japan")
-	RootCmd.PersistentFlags().StringVar(&profileName, "profile-name", "nssh", "Specify SORACOM CLI profile name")
+// commands which do not use SORACOM API, so work without valid credentials
+var noClientCommands = map[string]bool{
+	"version":    true,
+	"profiles":   true,
+	"completion": true,
+	"doctor":     true,
+	"exec":       true,
+	"help":       true,
 
-	cobra.OnInitialize(initConfig)
+	// hidden command of cobra to complete the command line, also called as
+	// cobra.ShellCompNoDescRequestCmd which is its alias
+	cobra.ShellCompRequestCmd: true,
+}
+
+func init() {
+	RootCmd.PersistentFlags().StringVar(&coverageType, "coverage-type", "", "Specify coverage type, \"g\" or \"global\" for Global, \"jp\" or \"japan\" for Japan, \"sandbox\" for API sandbox, or \"auto\" to search the subscriber on Japan then Global, case-insensitive. Coverage type of the profile, SORACOM_COVERAGE_TYPE environment variable, then auto is used if not specified")
+	RootCmd.PersistentFlags().StringVar(&profileName, "profile-name", "nssh", "Specify SORACOM CLI profile name. Ignored if SORACOM_API_KEY and SORACOM_TOKEN, or SORACOM_AUTH_KEY_ID and SORACOM_AUTH_KEY environment variables are set, in this order of precedence")
+	RootCmd.PersistentFlags().IntVar(&tokenTimeout, "token-timeout", 0, "Specify timeout of SORACOM API token in seconds, 180-172800, e.g. shorter one for CI. NSSH_TOKEN_TIMEOUT environment variable, then 86400 (24 hours) is used if not specified")
+	RootCmd.PersistentFlags().CountVarP(&verbose, "verbose", "v", "Show debug log to stderr. -v for API requests, -vv for SSH handshake, -vvv for request and response bodies. Credentials are never logged")
+	RootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "text", "Specify format of progress messages, \"text\" for human readable messages to stdout, \"json\" for an event per line to stderr")
+	RootCmd.PersistentFlags().BoolVarP(&quietProgress, "quiet", "q", false, "Do not show progress messages, e.g. in scripts. Errors and the output of the device are still shown. Events of --log-format json are not affected. For list, print only the endpoints of port mappings instead")
+	RootCmd.PersistentFlags().BoolVar(&noProgress, "no-progress", false, "Do not show spinner while waiting for port mapping creation or SSH connection. The spinner is not shown either if stdout is not a terminal")
+	RootCmd.PersistentFlags().StringVar(&lang, "lang", "", "Specify language of messages, \"en\" or \"ja\". Determined from the locale, e.g. LANG environment variable if not specified")
+	RootCmd.PersistentFlags().IntVar(&simLimit, "limit", 0, "Specify maximum number of SIMs to fetch when searching SIMs, 0 for unlimited")
+	RootCmd.PersistentFlags().BoolVar(&noCache, "no-cache", false, "Do not reuse API token cached under the profile directory, and authenticate again")
+	RootCmd.PersistentFlags().StringVar(&endpoint, "endpoint", "", "Specify base URL of SORACOM API, e.g. for a staging environment, instead of the one for the coverage type")
+	RootCmd.PersistentFlags().StringVar(&checkIPURL, "checkip-url", "", "Specify the endpoint which returns current global IP address in plain text. NSSH_CHECKIP_URL environment variable, then https://checkip.amazonaws.com/ is used if not specified")
+	RootCmd.PersistentFlags().StringVar(&traceFile, "trace-file", "", "Append each request to SORACOM API and its response to specified file, e.g. for support tickets. API key, token, auth key and password are redacted")
+	RootCmd.PersistentFlags().StringVar(&proxy, "proxy", "", "Specify HTTP(S) proxy URL for SORACOM API, e.g. http://proxy.example.com:8080. HTTPS_PROXY environment variable is used if not specified")
+	RootCmd.PersistentFlags().StringVar(&mockFile, "mock", "", "Use SIMs and port mappings in specified JSON file instead of SORACOM API, e.g. for demos. Port mappings are created and deleted in memory, and connect to the endpoint in the file. NSSH_MOCK environment variable is used if not specified")
+	RootCmd.PersistentFlags().StringVar(&caCert, "ca-cert", "", "Specify a path to PEM encoded CA certificate to trust in addition to the system ones, e.g. for TLS-intercepting proxy")
 
 	RootCmd.AddCommand(listCmd())
 	RootCmd.AddCommand(connectCmd())
 	RootCmd.AddCommand(versionCmd())
 	RootCmd.AddCommand(interactiveCmd())
-
-	RootCmd.CompletionOptions.HiddenDefaultCmd = true
+	RootCmd.AddCommand(multiplexCmd())
+	RootCmd.AddCommand(sshCmd())
+	RootCmd.AddCommand(renewCmd())
+	RootCmd.AddCommand(deleteCmd())
+	RootCmd.AddCommand(runCmd())
+	RootCmd.AddCommand(batchCmd())
+	RootCmd.AddCommand(tunnelCmd())
+	RootCmd.AddCommand(forwardCmd())
+	RootCmd.AddCommand(execCmd())
+	RootCmd.AddCommand(whoamiCmd())
+	RootCmd.AddCommand(statusCmd())
+	RootCmd.AddCommand(doctorCmd())
+	RootCmd.AddCommand(authCmd())
+	RootCmd.AddCommand(profilesCmd())
+	RootCmd.AddCommand(completionCmd())
 }
 
+// initConfig sets up the language, the logger and the emitter from the flags
 func initConfig() {
-	var err error
-	client, err = nssh.NewSoracomClient(coverageType, profileName)
+	logger = nssh.NewLogger(os.Stderr, verbose)
+
+	if evalOutput {
+		// keep stdout only for the lines to eval, including errors printed
+		// with fmt.Println
+		evalStdout = os.Stdout
+		os.Stdout = os.Stderr
+	}
+
+	if lang == "" {
+		lang = nssh.SystemLang()
+	}
+	if lang != "en" && lang != "ja" {
+		exitWithError(usageErrorf("invalid language: %s", lang))
+	}
+
+	switch logFormat {
+	case "text":
+		if quietProgress || quiet {
+			// list --quiet is for scripts as well
+			emitter = nssh.NewTextEmitter(io.Discard, lang)
+			break
+		}
+		emitter = nssh.NewTextEmitter(os.Stdout, lang)
+		emitter.SetSpinner(!noProgress && terminal.IsTerminal(int(os.Stdout.Fd())))
+	case "json":
+		emitter = nssh.NewJSONEmitter(os.Stderr)
+	default:
+		exitWithError(usageErrorf("invalid log format: %s", logFormat))
+	}
+}
+
+// initTokenTimeout reads NSSH_TOKEN_TIMEOUT environment variable unless
+// --token-timeout is specified, and validates it
+func initTokenTimeout() {
+	if tokenTimeout == 0 {
+		v := os.Getenv("NSSH_TOKEN_TIMEOUT")
+		if v == "" {
+			return
+		}
+		var err error
+		if tokenTimeout, err = strconv.Atoi(v); err != nil {
+			exitWithError(usageErrorf("invalid NSSH_TOKEN_TIMEOUT %s, specify in seconds", v))
+		}
+	}
+	if err := nssh.ValidateTokenTimeout(tokenTimeout); err != nil {
+		exitWithError(usageErrorf("%w", err))
+	}
+}
+
+// initIdentity reads PEM encoded private key from stdin with --identity-stdin,
+// or from SORACOM_SSH_KEY environment variable, not to write it to disk
+func initIdentity() {
+	if agentOnly {
+		if identity != "" || identityStdin || os.Getenv("SORACOM_SSH_KEY") != "" {
+			exitWithError(usageErrorf("cannot use --identity, --identity-stdin nor SORACOM_SSH_KEY environment variable with --identity-from-agent-only"))
+		}
+		return
+	}
+	if identityStdin {
+		if identity != "" {
+			exitWithError(usageErrorf("cannot specify both --identity and --identity-stdin"))
+		}
+		b, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Println("nssh: failed to read private key from stdin: ", err)
+			os.Exit(1)
+		}
+		identityPEM = b
+		return
+	}
+	if identity == "" {
+		identityPEM = []byte(os.Getenv("SORACOM_SSH_KEY"))
+	}
+}
+
+// initPassword reads the password of the device from --password-file, or from
+// SORACOM_SSH_PASSWORD environment variable, not to ask it interactively
+func initPassword() {
+	if agentOnly && passwordFile != "" {
+		exitWithError(usageErrorf("cannot use --password-file with --identity-from-agent-only"))
+	}
+	if passwordFile != "" {
+		b, err := os.ReadFile(passwordFile)
+		if err != nil {
+			fmt.Printf("nssh: failed to read password: %v\n", err)
+			os.Exit(1)
+		}
+		password, _, _ = strings.Cut(string(b), "\n")
+		password = strings.TrimSuffix(password, "\r")
+		if password == "" {
+			fmt.Printf("nssh: no password in %s\n", passwordFile)
+			os.Exit(1)
+		}
+		return
+	}
+
+	password = os.Getenv("SORACOM_SSH_PASSWORD")
+	if password != "" && identity == "" && len(identityPEM) == 0 && !agentOnly {
+		emitter.Emit("password_from_env", nil, "→ use password in SORACOM_SSH_PASSWORD environment variable, which other processes of the user may read. Consider public key authentication")
+	}
+}
+
+// initClient creates the client, which authenticates with SORACOM API
+func initClient() {
+	options, err := clientOptions()
 	if err != nil {
 		fmt.Println("failed to create a client: ", err)
 		os.Exit(1)
 	}
+
+	if mockFile == "" {
+		mockFile = os.Getenv("NSSH_MOCK")
+	}
+	if mockFile != "" {
+		data, err := nssh.LoadMockData(mockFile)
+		if err != nil {
+			fmt.Println("failed to create a client: ", err)
+			os.Exit(1)
+		}
+		logger.Debug("use mock data instead of SORACOM API", "path", mockFile)
+		client, err = nssh.NewMockSoracomClient(data, options...)
+		if err != nil {
+			fmt.Println("failed to create a client: ", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	start := time.Now()
+	client, err = nssh.NewSoracomClient(coverageType, profileName, options...)
+	if err != nil {
+		fmt.Println("failed to create a client: ", err)
+		os.Exit(exitCodeOf(err))
+	}
+	timings.Record("API authentication", start)
+}
+
+// clientOptions returns options for nssh.NewSoracomClient built from the flags
+func clientOptions() ([]nssh.Option, error) {
+	httpClient, err := nssh.NewHTTPClient(proxy, caCert)
+	if err != nil {
+		return nil, err
+	}
+
+	if traceFile != "" {
+		f, err := os.OpenFile(traceFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, err
+		}
+		httpClient.Transport = nssh.NewTraceTransport(httpClient.Transport, f)
+	}
+
+	options := []nssh.Option{
+		nssh.WithHTTPClient(httpClient),
+		nssh.WithLogger(logger),
+		nssh.WithEmitter(emitter),
+		nssh.WithLang(lang),
+		nssh.WithSIMLimit(simLimit),
+	}
+	if tokenTimeout != 0 {
+		options = append(options, nssh.WithTokenTimeout(tokenTimeout))
+	}
+	if noCache {
+		options = append(options, nssh.WithoutTokenCache())
+	}
+	if endpoint != "" {
+		options = append(options, nssh.WithEndpoint(endpoint))
+	}
+	if checkIPURL == "" {
+		checkIPURL = os.Getenv("NSSH_CHECKIP_URL")
+	}
+	if checkIPURL != "" {
+		options = append(options, nssh.WithCheckIPEndpoint(checkIPURL))
+	}
+	return options, nil
 }
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"io"
+	"testing"
+)
+
+func TestNoClientCommandsWithoutProfile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("SORACOM_PROFILE_DIR", home)
+	for _, env := range []string{"SORACOM_API_KEY", "SORACOM_TOKEN", "SORACOM_AUTH_KEY_ID", "SORACOM_AUTH_KEY", "NSSH_MOCK"} {
+		t.Setenv(env, "")
+	}
+
+	for _, args := range [][]string{{"version"}, {"completion", "bash"}, {"profiles"}, {"help"}, {"__complete", "connect", ""}, {"__completeNoDesc", "connect", ""}} {
+		t.Run(args[0], func(t *testing.T) {
+			// initClient exits instead of returning an error if it is called
+			RootCmd.SetArgs(args)
+			RootCmd.SetOut(io.Discard)
+			t.Cleanup(func() { RootCmd.SetArgs(nil); RootCmd.SetOut(nil) })
+			if err := RootCmd.Execute(); err != nil {
+				t.Fatal(err)
+			}
+			if client != nil {
+				t.Errorf("client is created for %s", args[0])
+			}
+		})
+	}
+}
+
+func TestNoClientCommandsExist(t *testing.T) {
+	RootCmd.InitDefaultHelpCmd()
+	for name := range noClientCommands {
+		if name == cobra.ShellCompRequestCmd {
+			continue // cobra adds it only when it is called
+		}
+		if cmd, _, err := RootCmd.Find([]string{name}); err != nil || cmd.Name() != name {
+			t.Errorf("no command named %s in noClientCommands", name)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/0x6b/nssh"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"os"
+)
+
+var script string
+
+func runCmd() *cobra.Command {
+	runCmd := &cobra.Command{
+		Use:   "run [<user>@][name:|imsi:|sim:]<subscriber name> --script <file> [-- <args>...]",
+		Short: "Run local script on specified subscriber.",
+		Long:  "Upload local script to a temporary file on specified subscriber, run it with the arguments after --, and remove it. The output of the script is streamed, and nssh exits with the exit status of the script. The script is run directly, so specify the interpreter with shebang, e.g. #!/bin/sh.",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			defer tracker.watchSignals()()
+
+			if err := nssh.ValidatePortMapping(port, duration); err != nil {
+				exitWithError(usageErrorf("%w", err))
+			}
+			b, err := os.ReadFile(script)
+			if err != nil {
+				fmt.Printf("nssh: failed to read the script: %v\n", err)
+				os.Exit(1)
+			}
+
+			login, selector, value := parseArg(args[0])
+			sim, err := findOnlineSIM(selector, value)
+			if err != nil {
+				exitWithError(err)
+			}
+			if sim == nil {
+				return
+			}
+			user, _ := splitLogin(args[0])
+			login = applySSHConfig(cmd.Flags(), *sim, login, user != "")
+
+			portMapping, release, err := ensurePortMapping(*sim, port)
+			if err != nil {
+				exitWithError(err)
+			}
+
+			err = client.RunScript(login, identity, portMapping, b, args[1:], os.Stdout, os.Stderr, connectOptions())
+			release()
+			var exitError *ssh.ExitError
+			if errors.As(err, &exitError) {
+				os.Exit(exitError.ExitStatus())
+			}
+			if err = withConnectHint(login, err); err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+
+	runCmd.Flags().StringVar(&script, "script", "", "Specify a path to local script to run")
+	_ = runCmd.MarkFlagRequired("script")
+	addConnectFlags(runCmd)
+	return runCmd
+}
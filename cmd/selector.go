@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/0x6b/nssh/models"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"io"
+)
+
+var docStyle = lipgloss.NewStyle().Margin(1, 2)
+
+type model struct {
+	list    list.Model
+	multi   bool // toggle selection of SIMs with space
+	choice  *models.SIM
+	choices []models.SIM
+}
+
+// A selectableSIM is an item of the list which can be selected with others
+type selectableSIM struct {
+	models.SIM
+	selected bool
+}
+
+// Title marks the SIM selected or not
+func (s selectableSIM) Title() string {
+	if s.selected {
+		return "[x] " + s.SIM.Title()
+	}
+	return "[ ] " + s.SIM.Title()
+}
+
+func (m model) Init() tea.Cmd {
+	return nil
+}
+
+func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch pressed := msg.String(); pressed {
+		case "q", "esc", "ctrl+c":
+			return m, tea.Quit
+		case "enter":
+			if m.multi {
+				m.choices = m.selected()
+				return m, tea.Quit
+			}
+			s, ok := m.list.SelectedItem().(models.SIM)
+			if ok {
+				m.choice = &s
+			}
+			return m, tea.Quit
+		case " ":
+			if m.multi && m.list.FilterState() != list.Filtering {
+				return m, m.toggle()
+			}
+		}
+	case tea.WindowSizeMsg:
+		h, v := docStyle.GetFrameSize()
+		m.list.SetSize(msg.Width-h, msg.Height-v)
+	}
+
+	var cmd tea.Cmd
+	m.list, cmd = m.list.Update(msg)
+	return m, cmd
+}
+
+func (m model) View() string {
+	return docStyle.Render(m.list.View())
+}
+
+func (m model) Choice() *models.SIM {
+	return m.choice
+}
+
+// toggle toggles selection of the current SIM
+func (m *model) toggle() tea.Cmd {
+	current, ok := m.list.SelectedItem().(selectableSIM)
+	if !ok {
+		return nil
+	}
+	// the index of the list is in the filtered items, so find the item
+	for i, item := range m.list.Items() {
+		if s, ok := item.(selectableSIM); ok && s.ID == current.ID {
+			s.selected = !s.selected
+			return m.list.SetItem(i, s)
+		}
+	}
+	return nil
+}
+
+// selected returns the selected SIMs, or the current one if none is selected
+func (m model) selected() []models.SIM {
+	var sims []models.SIM
+	for _, item := range m.list.Items() {
+		if s, ok := item.(selectableSIM); ok && s.selected {
+			sims = append(sims, s.SIM)
+		}
+	}
+	if len(sims) == 0 {
+		if s, ok := m.list.SelectedItem().(selectableSIM); ok {
+			sims = append(sims, s.SIM)
+		}
+	}
+	return sims
+}
+
+// selectSIM shows the list of SIMs titled title, and returns the SIM selected
+// by the user, or nil if the user quits without selection
+func selectSIM(title string, sims []models.SIM) (*models.SIM, error) {
+	items := make([]list.Item, 0, len(sims))
+	for _, s := range sims {
+		items = append(items, s)
+	}
+
+	m, err := runSelector(model{list: newList(title, items)})
+	if err != nil {
+		return nil, err
+	}
+	return m.Choice(), nil
+}
+
+// selectSIMs shows the list of SIMs titled title, and returns the SIMs toggled
+// with space by the user, or the current one if none is toggled. Returns nil
+// if the user quits without selection.
+func selectSIMs(title string, sims []models.SIM) ([]models.SIM, error) {
+	items := make([]list.Item, 0, len(sims))
+	for _, s := range sims {
+		items = append(items, selectableSIM{SIM: s})
+	}
+
+	l := newList(title, items)
+	l.AdditionalShortHelpKeys = func() []key.Binding {
+		return []key.Binding{key.NewBinding(key.WithKeys(" "), key.WithHelp("space", "toggle"))}
+	}
+	m, err := runSelector(model{list: l, multi: true})
+	if err != nil {
+		return nil, err
+	}
+	return m.choices, nil
+}
+
+// A simDelegate renders the description of online SIMs in green, and offline
+// ones faint, unless selected
+type simDelegate struct {
+	list.DefaultDelegate
+}
+
+func (d simDelegate) Render(w io.Writer, m list.Model, index int, item list.Item) {
+	var online bool
+	switch s := item.(type) {
+	case models.SIM:
+		online = s.SessionStatus.Online
+	case selectableSIM:
+		online = s.SessionStatus.Online
+	}
+	if online {
+		d.Styles.NormalDesc = d.Styles.NormalDesc.Foreground(lipgloss.Color("42"))
+	} else {
+		d.Styles.NormalDesc = d.Styles.NormalDesc.Faint(true)
+	}
+	d.DefaultDelegate.Render(w, m, index, item)
+}
+
+// newList returns the list of items titled title
+func newList(title string, items []list.Item) list.Model {
+	delegate := list.NewDefaultDelegate()
+	delegate.Styles.SelectedDesc = delegate.Styles.SelectedDesc.Foreground(lipgloss.Color("#34cdd7")).Faint(true)
+	delegate.Styles.SelectedTitle = delegate.Styles.SelectedTitle.Foreground(lipgloss.Color("#34cdd7"))
+	delegate.Styles.FilterMatch = delegate.Styles.FilterMatch.Foreground(lipgloss.Color("#34cdd7"))
+
+	l := list.New(items, simDelegate{delegate}, 0, 0)
+	l.Title = title
+	l.Styles.Title = lipgloss.NewStyle().Background(lipgloss.Color("#34cdd7")).Foreground(lipgloss.Color("0")).Bold(true)
+	return l
+}
+
+// runSelector runs m until the user selects or quits
+func runSelector(m model) (model, error) {
+	p := tea.NewProgram(m, tea.WithAltScreen())
+
+	result, err := p.Run()
+	if err != nil {
+		return model{}, fmt.Errorf("could not start program: %w", err)
+	}
+	return result.(model), nil
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strings"
+)
+
+// initSourceCIDRs adds the CIDRs in --source-cidr-file to sourceCIDRs
+func initSourceCIDRs() {
+	if noAutoIP && sourceCIDRFile == "" {
+		exitWithError(usageErrorf("--no-auto-ip requires --source-cidr-file"))
+	}
+	if sourceCIDRFile == "" {
+		return
+	}
+
+	cidrs, err := readCIDRs(sourceCIDRFile)
+	if err != nil {
+		fmt.Printf("nssh: %v\n", err)
+		os.Exit(1)
+	}
+	sourceCIDRs = append(sourceCIDRs, cidrs...)
+}
+
+// readCIDRs reads CIDRs from path, one per line. Text after # is a comment,
+// and empty lines are ignored.
+func readCIDRs(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read source CIDRs: %w", err)
+	}
+	defer f.Close()
+
+	var cidrs []string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(line); err != nil {
+			return nil, fmt.Errorf("invalid source CIDR at %s:%d: %s", path, n, line)
+		}
+		cidrs = append(cidrs, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read source CIDRs: %w", err)
+	}
+	return cidrs, nil
+}
+
+// portMappingSourceCIDRs returns source CIDRs of new port mapping, i.e.
+// sourceCIDRs, and current global IP address if --source-cidr-file is
+// specified without --no-auto-ip
+func portMappingSourceCIDRs() []string {
+	if sourceCIDRFile == "" || noAutoIP {
+		return sourceCIDRs
+	}
+	// empty sourceCIDRs resolves to current IP address, or nothing if unknown
+	ipCIDRs, _ := client.ResolveSourceCIDRs(nil)
+	return append(slices.Clone(sourceCIDRs), ipCIDRs...)
+}
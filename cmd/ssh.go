@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"github.com/0x6b/nssh/models"
+	"github.com/spf13/cobra"
+	"net"
+	"strconv"
+	"strings"
+)
+
+func sshCmd() *cobra.Command {
+	sshCmd := &cobra.Command{
+		Use:   "ssh [<user>@]<host>:<port>",
+		Short: "Connect to specified port mapping endpoint via SSH, without looking up subscribers.",
+		Long:  "Connect to the endpoint of an existing port mapping, e.g. shown by list, via SSH directly. Neither subscribers nor port mappings are looked up or created. If <user>@ is not specified, the user specified with --login will be used.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			user, endpoint := login, args[0]
+			if i := strings.LastIndex(endpoint, "@"); i >= 0 {
+				if i > 0 {
+					user = endpoint[:i]
+				}
+				endpoint = endpoint[i+1:]
+			}
+
+			host, p, err := net.SplitHostPort(endpoint)
+			if err != nil {
+				exitWithError(usageErrorf("invalid endpoint \"%s\": %v", endpoint, err))
+			}
+			if _, err := strconv.Atoi(p); err != nil || host == "" {
+				exitWithError(usageErrorf("invalid endpoint \"%s\", specify as <host>:<port>", endpoint))
+			}
+
+			portMapping := &models.PortMapping{
+				Endpoint:    endpoint,
+				Hostname:    host,
+				TLSRequired: tlsRequired,
+			}
+
+			emitter.Emit("connecting", map[string]any{"login": user, "endpoint": endpoint}, "connect to %s@%s", user, endpoint)
+			err = withConnectHint(user, client.Connect(user, identity, portMapping, connectOptions()))
+			if err != nil {
+				exitWithError(err)
+			}
+		},
+	}
+
+	sshCmd.Flags().StringVarP(&login, "login", "u", defaultLogin(), "Specify login user name. SORACOM_DEFAULT_USER environment variable is the default if set")
+	sshCmd.Flags().StringVarP(&identity, "identity", "i", "", "Specify a path to file from which the identity for public key authentication is read")
+	sshCmd.Flags().BoolVar(&identityStdin, "identity-stdin", false, "Read PEM encoded private key for public key authentication from stdin, instead of file. SORACOM_SSH_KEY environment variable is used if set and neither is specified")
+	sshCmd.Flags().BoolVar(&agentOnly, "identity-from-agent-only", false, "Authenticate only with keys of the SSH agent at SSH_AUTH_SOCK, and fail instead of reading private key or asking password, e.g. not to let private keys leave the agent")
+	sshCmd.Flags().StringVar(&passwordFile, "password-file", "", "Specify a path to file whose first line is the password of the device, used instead of asking when no private key is specified. SORACOM_SSH_PASSWORD environment variable is used if not specified")
+	sshCmd.Flags().StringVar(&certificate, "certificate", "", "Specify a path to OpenSSH certificate signed by SSH CA, e.g. id_ed25519-cert.pub, to present with the private key")
+	sshCmd.Flags().BoolVar(&noPTY, "no-pty", false, "Do not allocate PTY for the remote shell, which is implied if stdin or stdout is not a terminal")
+	sshCmd.Flags().StringVar(&term, "term", "", "Specify terminal type of the remote PTY. TERM environment variable, then xterm is used if not specified")
+	sshCmd.Flags().BoolVar(&tlsRequired, "tls", false, "Connect to the endpoint over TLS")
+	sshCmd.Flags().BoolVar(&tlsInsecure, "tls-insecure", false, "Skip verification of the certificate of the endpoint with --tls")
+	sshCmd.Flags().StringVar(&proxyCommand, "proxy-command", "", "Specify command to connect to the endpoint through, like ProxyCommand of OpenSSH, e.g. \"ssh -W %h:%p bastion\". %h and %p are replaced with the host and the port of the endpoint")
+	sshCmd.Flags().IntVar(&connectTimeout, "connect-timeout", 0, "Specify timeout in seconds to connect and complete SSH handshake, e.g. for devices slow to present SSH banner, 0 to wait forever")
+	sshCmd.Flags().IntVar(&serverAliveInterval, "server-alive-interval", 30, "Specify interval in seconds to send keepalive requests to the server, 0 to disable")
+	sshCmd.Flags().IntVar(&serverAliveCountMax, "server-alive-count-max", 3, "Specify number of keepalive requests which may be unanswered before disconnecting")
+	addAlgorithmFlags(sshCmd)
+	return sshCmd
+}
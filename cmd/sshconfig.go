@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"github.com/0x6b/nssh"
+	"github.com/0x6b/nssh/models"
+	"github.com/kevinburke/ssh_config"
+	"github.com/spf13/pflag"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// applySSHConfig applies User, IdentityFile, Port and ServerAliveInterval in
+// ~/.ssh/config for the Host pattern which matches the subscriber name (or SIM
+// ID if the SIM has no name) to the settings which are not specified with
+// flags, and returns the login user name to use. login is kept if
+// loginSpecified is true.
+func applySSHConfig(flags *pflag.FlagSet, sim models.SIM, login string, loginSpecified bool) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return login
+	}
+	path := filepath.Join(home, ".ssh", "config")
+	f, err := os.Open(path)
+	if err != nil {
+		return login
+	}
+	defer f.Close()
+
+	config, err := ssh_config.Decode(f)
+	if err != nil {
+		emitter.Emit("ssh_config_ignored", map[string]any{"path": path, "error": err}, "→ ignore %s: %v", path, err)
+		return login
+	}
+
+	host := sim.Tags.Name
+	if host == "" {
+		host = sim.ID
+	}
+	get := func(key string) string {
+		v, _ := config.Get(host, key)
+		return v
+	}
+
+	if v := get("User"); v != "" && !loginSpecified {
+		login = v
+	}
+	// ignored if the private key is read from stdin or SORACOM_SSH_KEY, or only
+	// SSH agent is used
+	if v := get("IdentityFile"); v != "" && !flags.Changed("identity") && !agentOnly && len(identityPEM) == 0 {
+		if v == "~" || strings.HasPrefix(v, "~/") {
+			v = filepath.Join(home, v[1:])
+		}
+		identity = v
+	}
+	if v := get("Port"); v != "" && !flags.Changed("port") {
+		p, err := strconv.Atoi(v)
+		if err == nil {
+			err = nssh.ValidatePortMapping(p, duration)
+		}
+		if err != nil {
+			emitter.Emit("ssh_config_ignored", map[string]any{"path": path, "key": "Port", "value": v, "error": err}, "→ ignore Port %s in %s: %v", v, path, err)
+		} else {
+			port = p
+		}
+	}
+	if v := get("ServerAliveInterval"); v != "" && !flags.Changed("server-alive-interval") {
+		if i, err := strconv.Atoi(v); err == nil {
+			serverAliveInterval = i
+		}
+	}
+
+	logger.Debug("apply SSH config", "path", path, "host", host, "login", login, "identity", identity, "port", port, "serverAliveInterval", serverAliveInterval)
+	return login
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+var statusJSON bool
+
+// A status represents summary of the account shown by status command. Counts
+// and IP address are nil if failed to fetch, with the error in Errors.
+type status struct {
+	Profile      string            `json:"profile"`
+	Endpoint     string            `json:"endpoint"`
+	IPAddress    *string           `json:"ipAddress"`
+	PortMappings *int              `json:"portMappings"`
+	OnlineSIMs   *int              `json:"onlineSims"`
+	Errors       map[string]string `json:"errors,omitempty"`
+}
+
+func statusCmd() *cobra.Command {
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show summary of Napter usage of the account.",
+		Long:  "Show the profile and the endpoint in use, current global IP address, and the number of active port mappings and online SIMs. Items which fail to fetch are reported, and the others are still shown.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			s := getStatus()
+
+			if statusJSON {
+				b, err := json.MarshalIndent(s, "", "  ")
+				if err != nil {
+					exitWithError(err)
+				}
+				fmt.Println(string(b))
+			} else {
+				fmt.Printf("Profile:        %s\n", s.Profile)
+				fmt.Printf("Endpoint:       %s\n", s.Endpoint)
+				fmt.Printf("IP address:     %s\n", statusValue(s.IPAddress, s.Errors["ipAddress"]))
+				fmt.Printf("Port mappings:  %s\n", statusValue(s.PortMappings, s.Errors["portMappings"]))
+				fmt.Printf("Online SIMs:    %s\n", statusValue(s.OnlineSIMs, s.Errors["onlineSims"]))
+			}
+
+			if len(s.Errors) > 0 {
+				os.Exit(1)
+			}
+		},
+	}
+
+	statusCmd.Flags().BoolVar(&statusJSON, "json", false, "Print the summary as JSON")
+	return statusCmd
+}
+
+// getStatus fetches the summary, recording the errors instead of failing
+func getStatus() status {
+	s := status{
+		Profile:  profileName,
+		Endpoint: client.APIEndpoint(),
+		Errors:   map[string]string{},
+	}
+
+	if ip, err := client.IPChecker().GetIP(); err != nil {
+		s.Errors["ipAddress"] = err.Error()
+	} else {
+		v := ip.String()
+		s.IPAddress = &v
+	}
+
+	if portMappings, err := client.ListPortMappings(); err != nil {
+		s.Errors["portMappings"] = err.Error()
+	} else {
+		n := len(portMappings)
+		s.PortMappings = &n
+	}
+
+	if sims, err := client.FindOnlineSIMs(); err != nil {
+		s.Errors["onlineSims"] = err.Error()
+	} else {
+		n := len(sims)
+		s.OnlineSIMs = &n
+	}
+	return s
+}
+
+// statusValue returns v, or the error if v is nil
+func statusValue[T any](v *T, err string) string {
+	if v == nil {
+		return "failed: " + err
+	}
+	return fmt.Sprint(*v)
+}
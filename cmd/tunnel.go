@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/0x6b/nssh"
+	"github.com/spf13/cobra"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+var controlSocket string
+
+func tunnelCmd() *cobra.Command {
+	tunnelCmd := &cobra.Command{
+		Use:   "tunnel [<user>@][name:|imsi:|sim:]<subscriber name> --control <socket>",
+		Short: "Keep SSH connection to specified subscriber open for exec --control (experimental).",
+		Long:  "Connect to specified subscriber via SSH, and keep the connection open until interrupted, like ControlMaster of OpenSSH. Commands run with `nssh exec --control <socket>` are multiplexed over the connection as new sessions, without creating port mapping nor authenticating again. The socket is removed on exit. Experimental: stdin is not forwarded to the commands.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			stopWatching := tracker.watchSignals()
+
+			if err := nssh.ValidatePortMapping(port, duration); err != nil {
+				exitWithError(usageErrorf("%w", err))
+			}
+
+			user, loginSpecified, target := loginOf(cmd.Flags(), args[0])
+			login = user
+			selector, value := parseSelector(target)
+			sim, err := findOnlineSIM(selector, value)
+			if err != nil {
+				exitWithError(err)
+			}
+			if sim == nil {
+				return
+			}
+			login = applySSHConfig(cmd.Flags(), *sim, login, loginSpecified)
+
+			portMapping, release, err := ensurePortMapping(*sim, port)
+			if err != nil {
+				exitWithError(err)
+			}
+			defer release()
+
+			sshClient, err := client.Dial(login, identity, portMapping, connectOptions())
+			if err != nil {
+				release()
+				exitWithError(withConnectHint(login, err))
+			}
+			defer sshClient.Close()
+
+			l, err := listenControl(controlSocket)
+			if err != nil {
+				release()
+				fmt.Printf("nssh: failed to listen on %s: %v\n", controlSocket, err)
+				os.Exit(1)
+			}
+			defer l.Close() // removes the socket
+			go serveControl(l, sshClient)
+
+			// stop on the signals by ourselves, to remove the socket
+			stopWatching()
+			ch := make(chan os.Signal, 1)
+			signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+			defer signal.Stop(ch)
+			closed := make(chan error, 1)
+			go func() {
+				closed <- sshClient.Wait()
+			}()
+
+			emitter.Emit("tunnel_ready", map[string]any{"simId": sim.ID, "socket": controlSocket}, "→ run commands with `nssh exec --control %s -- <command>`, press Ctrl+C to close", controlSocket)
+			select {
+			case <-ch:
+			case err := <-closed:
+				emitter.Emit("tunnel_closed", map[string]any{"simId": sim.ID, "error": err}, "→ the connection is closed: %v", err)
+			}
+		},
+	}
+
+	tunnelCmd.Flags().StringVar(&controlSocket, "control", "", "Specify a path to unix socket to listen for exec --control")
+	_ = tunnelCmd.MarkFlagRequired("control")
+	tunnelCmd.Flags().StringVarP(&login, "login", "u", defaultLogin(), "Specify login user name. SORACOM_DEFAULT_USER environment variable is the default if set")
+	addConnectFlags(tunnelCmd)
+	return tunnelCmd
+}
+
+func execCmd() *cobra.Command {
+	execCmd := &cobra.Command{
+		Use:   "exec --control <socket> -- <command>",
+		Short: "Run command over SSH connection kept open by tunnel (experimental).",
+		Long:  "Run the command in new session over the SSH connection kept open by `nssh tunnel`, and exit with its exit status. Neither subscribers nor port mappings are looked up, and no authentication is needed.",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			code, err := runViaControl(controlSocket, strings.Join(args, " "))
+			if err != nil {
+				fmt.Printf("nssh: %v\n", err)
+				os.Exit(exitCodeOf(err))
+			}
+			os.Exit(code)
+		},
+	}
+
+	execCmd.Flags().StringVar(&controlSocket, "control", "", "Specify a path to unix socket of the tunnel")
+	_ = execCmd.MarkFlagRequired("control")
+	return execCmd
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/0x6b/nssh/models"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+var showAccess bool
+
+func whoamiCmd() *cobra.Command {
+	whoamiCmd := &cobra.Command{
+		Use:     "whoami",
+		Aliases: []string{"ip"},
+		Short:   "Show current global IP address, which is permitted by port mappings created by nssh.",
+		Long:    "Show current global IP address, which is permitted by port mappings created by nssh unless --source-cidr is specified. With --show-access, also list existing port mappings which permit connections from the address.",
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			ip, err := client.IPChecker().GetIP()
+			if err != nil {
+				fmt.Printf("nssh: failed to determine current IP address: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println(ip)
+
+			if !showAccess {
+				return
+			}
+
+			portMappings, err := client.ListPortMappings()
+			if err != nil {
+				exitWithError(err)
+			}
+
+			var allowed []models.PortMapping
+			for _, pm := range portMappings {
+				if pm.AllowsIP(ip) {
+					allowed = append(allowed, pm)
+				}
+			}
+			if len(allowed) == 0 {
+				fmt.Printf("no port mapping permits %s\n", ip)
+				return
+			}
+
+			for _, pm := range allowed {
+				fmt.Println(pm)
+			}
+		},
+	}
+
+	whoamiCmd.Flags().BoolVar(&showAccess, "show-access", false, "List existing port mappings which permit connections from current global IP address")
+	return whoamiCmd
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+// +build !windows
+
+package nssh
+
+// enableVirtualTerminal does nothing, as terminals other than Windows console
+// handle virtual terminal sequences
+func enableVirtualTerminal() (func(), error) {
+	return func() {}, nil
+}
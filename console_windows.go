@@ -0,0 +1,42 @@
+//go:build windows
+// +build windows
+
+package nssh
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// enableVirtualTerminal enables virtual terminal sequences on the console, so
+// that colors and cursor movements from the remote PTY are rendered, and arrow
+// keys are sent as escape sequences, even in older consoles than Windows
+// Terminal. Returned function restores the console modes.
+func enableVirtualTerminal() (func(), error) {
+	var restores []func()
+	for _, c := range []struct {
+		handle windows.Handle
+		mode   uint32
+	}{
+		{windows.Stdin, windows.ENABLE_VIRTUAL_TERMINAL_INPUT},
+		{windows.Stdout, windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING | windows.ENABLE_PROCESSED_OUTPUT},
+	} {
+		var mode uint32
+		if err := windows.GetConsoleMode(c.handle, &mode); err != nil {
+			continue
+		}
+		if err := windows.SetConsoleMode(c.handle, mode|c.mode); err != nil {
+			for _, restore := range restores {
+				restore()
+			}
+			return nil, err
+		}
+		handle := c.handle
+		restores = append(restores, func() { _ = windows.SetConsoleMode(handle, mode) })
+	}
+
+	return func() {
+		for _, restore := range restores {
+			restore()
+		}
+	}, nil
+}
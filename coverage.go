@@ -0,0 +1,168 @@
+package nssh
+
+import (
+	"errors"
+	"github.com/0x6b/nssh/models"
+)
+
+// coverageClient is the client for another coverage type of the client
+// created with AutoCoverageType, or the error creating it
+type coverageClient struct {
+	client *SoracomClient
+	err    error
+}
+
+// forCoverage returns the client for coverageType with the same credentials
+// source and options as c, creating it on the first call. The client shares
+// CheckIP with c, so that it is modified once, e.g. for a jump host.
+func (c *SoracomClient) forCoverage(coverageType string) (*SoracomClient, error) {
+	c.coverageMu.Lock()
+	defer c.coverageMu.Unlock()
+
+	if cc, ok := c.coverageClients[coverageType]; ok {
+		return cc.client, cc.err
+	}
+	if c.coverageClients == nil {
+		c.coverageClients = map[string]coverageClient{}
+	}
+	var cc coverageClient
+	if c.newFor == nil {
+		cc.err = errors.New("the client cannot switch coverage type")
+	} else if cc.client, cc.err = c.newFor(coverageType); cc.err == nil {
+		cc.client.CheckIP = c.CheckIP
+	}
+	c.coverageClients[coverageType] = cc
+	return cc.client, cc.err
+}
+
+// otherCoverages returns coverage types other than the one of c in order of
+// CoverageTypes, or nil unless c is created with AutoCoverageType
+func (c *SoracomClient) otherCoverages() []string {
+	if !c.autoCoverage {
+		return nil
+	}
+	var others []string
+	for _, ct := range CoverageTypes {
+		if ct != c.coverageType {
+			others = append(others, ct)
+		}
+	}
+	return others
+}
+
+// remember records that the SIM or the subscriber, i.e. its SIM ID or IMSI,
+// is found on the coverage of o, so that port mappings for it are managed with
+// o
+func (c *SoracomClient) remember(id string, o *SoracomClient) {
+	c.coverageMu.Lock()
+	defer c.coverageMu.Unlock()
+	if c.simClients == nil {
+		c.simClients = map[string]*SoracomClient{}
+	}
+	c.simClients[id] = o
+}
+
+// clientFor returns the client for the coverage the SIM or the subscriber
+// with id is found on, or c if it is found on the coverage of c or not looked
+// up yet
+func (c *SoracomClient) clientFor(id string) *SoracomClient {
+	c.coverageMu.Lock()
+	defer c.coverageMu.Unlock()
+	if o, ok := c.simClients[id]; ok {
+		return o
+	}
+	return c
+}
+
+// searchCoverages returns SIMs or subscribers which find returns with c. If c
+// is created with AutoCoverageType and find returns none or an error wrapping
+// ErrSIMNotFound, find is called with the clients of the other coverage types
+// in order, and the ones found first are returned with the coverage recorded
+// for their id. Errors of the other coverage types, e.g. as the API key and
+// token are only valid on the first one, are ignored and the result of c is
+// returned.
+func searchCoverages[T any](c *SoracomClient, find func(*SoracomClient) ([]T, error), id func(T) string) ([]T, error) {
+	found, err := find(c)
+	if !notFound(found, err) {
+		return found, err
+	}
+
+	from := c.coverageType
+	for _, ct := range c.otherCoverages() {
+		c.Emitter.Emit("coverage_searching", map[string]any{"coverageType": ct}, "→ not found on %s coverage, search %s coverage", coverageName(from), coverageName(ct))
+		from = ct
+		o, oerr := c.forCoverage(ct)
+		if oerr != nil {
+			c.Logger.Debug("failed to create client for coverage type", "coverageType", ct, "error", oerr)
+			continue
+		}
+		s, e := find(o)
+		if e != nil || len(s) == 0 {
+			c.Logger.Debug("not found on coverage type", "coverageType", ct, "error", e)
+			continue
+		}
+		for _, v := range s {
+			c.remember(id(v), o)
+		}
+		c.Emitter.Emit("coverage_found", map[string]any{"coverageType": ct}, "→ found SIM on %s coverage", coverageName(ct))
+		return s, nil
+	}
+	return found, err
+}
+
+// simKey and subscriberKey are id of searchCoverages for SIMs and subscribers
+func simKey(sim models.SIM) string                      { return sim.ID }
+func subscriberKey(subscriber models.Subscriber) string { return subscriber.IMSI }
+
+// notFound returns true if the result of a lookup tells nothing is found
+func notFound[T any](found []T, err error) bool {
+	if err != nil {
+		return errors.Is(err, ErrSIMNotFound)
+	}
+	return len(found) == 0
+}
+
+// single returns the SIM or the subscriber looked up by a method of c as the
+// result of find of searchCoverages
+func single[T any](v *T, err error) ([]T, error) {
+	if err != nil {
+		return nil, err
+	}
+	return []T{*v}, nil
+}
+
+// first returns the SIM or the subscriber of the result of searchCoverages
+// with single
+func first[T any](found []T, err error) (*T, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &found[0], nil
+}
+
+// otherClients returns the clients of the other coverage types if c is
+// created with AutoCoverageType, skipping the ones which cannot be created
+func (c *SoracomClient) otherClients() []*SoracomClient {
+	var clients []*SoracomClient
+	for _, ct := range c.otherCoverages() {
+		o, err := c.forCoverage(ct)
+		if err != nil {
+			c.Logger.Debug("failed to create client for coverage type", "coverageType", ct, "error", err)
+			continue
+		}
+		clients = append(clients, o)
+	}
+	return clients
+}
+
+// coverageName returns human readable name of the coverage type
+func coverageName(coverageType string) string {
+	switch coverageType {
+	case "jp":
+		return "Japan"
+	case "g":
+		return "Global"
+	default:
+		return coverageType
+	}
+}
@@ -0,0 +1,210 @@
+package nssh
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// hostTransport routes requests to the transport for the host of the URL
+type hostTransport map[string]http.RoundTripper
+
+func (t hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if rt, ok := t[req.URL.Host]; ok {
+		return rt.RoundTrip(req)
+	}
+	return mockError(req, http.StatusNotFound, "unknown host "+req.URL.Host)
+}
+
+// mockData parses MockData from JSON
+func mockData(t *testing.T, s string) *MockData {
+	t.Helper()
+	var data MockData
+	if err := json.Unmarshal([]byte(s), &data); err != nil {
+		t.Fatal(err)
+	}
+	return &data
+}
+
+// newCoverageClient returns the client for coverageType whose Japan and Global
+// coverage are served from jp and g
+func newCoverageClient(t *testing.T, coverageType string, jp, g *MockData) *SoracomClient {
+	t.Helper()
+	t.Setenv("SORACOM_API_KEY", "api-key")
+	t.Setenv("SORACOM_TOKEN", "token")
+	t.Setenv("SORACOM_COVERAGE_TYPE", "")
+	c, err := NewSoracomClient(coverageType, "nssh", WithTransport(hostTransport{
+		"api.soracom.io":      NewMockTransport(jp),
+		"g.api.soracom.io":    NewMockTransport(g),
+		"checkip.example.com": NewMockTransport(jp),
+	}), WithCheckIPEndpoint("https://checkip.example.com/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+const (
+	japanSIMs  = `{"sims": [{"simId": "8981100000000000001", "tags": {"name": "jp-device"}, "sessionStatus": {"online": true}}]}`
+	globalSIMs = `{"sims": [{"simId": "8942310000000000001", "tags": {"name": "g-device"}, "sessionStatus": {"online": true}}]}`
+)
+
+func TestAutoCoverageFindsSIMOnGlobal(t *testing.T) {
+	c := newCoverageClient(t, "", mockData(t, japanSIMs), mockData(t, globalSIMs))
+	if !c.AutoCoverage() || c.CoverageType() != "jp" {
+		t.Fatalf("coverage type = %q, auto = %v, want jp, true", c.CoverageType(), c.AutoCoverage())
+	}
+
+	sims, err := c.FindOnlineSIMsByName("g-device")
+	if err != nil || len(sims) != 1 || sims[0].ID != "8942310000000000001" {
+		t.Fatalf("FindOnlineSIMsByName() = %v, %v", sims, err)
+	}
+
+	// port mappings for the SIM are created on Global coverage
+	pm, err := c.CreatePortMappingForSIM(sims[0], 22, 60, []string{"192.0.2.1/32"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := c.FindPortMappingsForSIM(sims[0])
+	if err != nil || len(found) != 1 {
+		t.Fatalf("FindPortMappingsForSIM() = %v, %v", found, err)
+	}
+	g, err := c.forCoverage("g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if onGlobal, _ := g.FindPortMappingsForSIM(sims[0]); len(onGlobal) != 1 {
+		t.Errorf("port mapping is not created on Global coverage: %v", onGlobal)
+	}
+	if err := c.DeletePortMapping(pm); err != nil {
+		t.Errorf("DeletePortMapping() = %v", err)
+	}
+}
+
+func TestAutoCoverageLookups(t *testing.T) {
+	c := newCoverageClient(t, "auto", mockData(t, japanSIMs), mockData(t, globalSIMs))
+
+	if sim, err := c.GetSIM("8942310000000000001"); err != nil || sim.Tags.Name != "g-device" {
+		t.Errorf("GetSIM() = %v, %v", sim, err)
+	}
+	if sim, err := c.GetSIM("8981100000000000001"); err != nil || sim.Tags.Name != "jp-device" {
+		t.Errorf("GetSIM() = %v, %v", sim, err)
+	}
+	if _, err := c.GetSIM("9999"); !errors.Is(err, ErrSIMNotFound) {
+		t.Errorf("GetSIM() of unknown SIM = %v, want ErrSIMNotFound", err)
+	}
+	if sims, err := c.FindOnlineSIMs(); err != nil || len(sims) != 2 {
+		t.Errorf("FindOnlineSIMs() = %v, %v, want SIMs of both coverage types", sims, err)
+	}
+}
+
+func TestAutoCoverageListsPortMappingsOfAllCoverages(t *testing.T) {
+	jp := mockData(t, `{"portMappings": [{"ipAddress": "192.0.2.10", "port": 1, "destination": {"simId": "jp-sim"}}]}`)
+	g := mockData(t, `{"portMappings": [{"ipAddress": "192.0.2.20", "port": 2, "destination": {"simId": "g-sim"}}]}`)
+	c := newCoverageClient(t, "auto", jp, g)
+
+	pms, err := c.ListPortMappings()
+	if err != nil || len(pms) != 2 {
+		t.Fatalf("ListPortMappings() = %v, %v", pms, err)
+	}
+	// deleted on the coverage it is listed on
+	if err := c.DeletePortMapping(&pms[1]); err != nil {
+		t.Errorf("DeletePortMapping() = %v", err)
+	}
+}
+
+func TestCoverageTypeWithoutFallback(t *testing.T) {
+	c := newCoverageClient(t, "japan", mockData(t, japanSIMs), mockData(t, globalSIMs))
+	if c.AutoCoverage() || c.CoverageType() != "jp" {
+		t.Fatalf("coverage type = %q, auto = %v, want jp, false", c.CoverageType(), c.AutoCoverage())
+	}
+	if sims, err := c.FindOnlineSIMsByName("g-device"); err != nil || len(sims) != 0 {
+		t.Errorf("FindOnlineSIMsByName() = %v, %v, want not found on Japan coverage", sims, err)
+	}
+	if _, err := c.GetSIM("8942310000000000001"); !errors.Is(err, ErrSIMNotFound) {
+		t.Errorf("GetSIM() = %v, want ErrSIMNotFound", err)
+	}
+}
+
+func TestNormalizeCoverageType(t *testing.T) {
+	tests := []struct {
+		coverageType string
+		want         string
+		wantErr      bool
+	}{
+		{coverageType: "g", want: "g"},
+		{coverageType: "global", want: "g"},
+		{coverageType: "Global", want: "g"},
+		{coverageType: "G", want: "g"},
+		{coverageType: "jp", want: "jp"},
+		{coverageType: "japan", want: "jp"},
+		{coverageType: "JAPAN", want: "jp"},
+		{coverageType: "sandbox", want: "sandbox"},
+		{coverageType: "auto", want: AutoCoverageType},
+		{coverageType: "Auto", want: AutoCoverageType},
+		{coverageType: "", wantErr: true},
+		{coverageType: "us", wantErr: true},
+		{coverageType: "jpn", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.coverageType, func(t *testing.T) {
+			got, err := NormalizeCoverageType(tt.coverageType)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("NormalizeCoverageType(%q) = %q, %v, want %q, error %v", tt.coverageType, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCoverageTypeEndpoint(t *testing.T) {
+	tests := []struct {
+		coverageType string // of the argument
+		profile      string // coverage type of the profile
+		env          string // SORACOM_COVERAGE_TYPE, used with auth key of environment variables instead of the profile
+		want         string
+		wantErr      bool
+	}{
+		{coverageType: "Global", want: "https://g.api.soracom.io"},
+		{coverageType: "japan", want: "https://api.soracom.io"},
+		{coverageType: "sandbox", want: "https://api-sandbox.soracom.io"},
+		{profile: "global", want: "https://g.api.soracom.io"},
+		{env: "GLOBAL", want: "https://g.api.soracom.io"},
+		{coverageType: "japan", profile: "global", want: "https://api.soracom.io"},
+		{want: "https://api.soracom.io"},
+		{coverageType: "mars", wantErr: true},
+		{profile: "mars", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.coverageType+"/"+tt.profile+"/"+tt.env, func(t *testing.T) {
+			t.Setenv("SORACOM_API_KEY", "")
+			t.Setenv("SORACOM_TOKEN", "")
+			t.Setenv("SORACOM_AUTH_KEY_ID", "")
+			t.Setenv("SORACOM_AUTH_KEY", "")
+			t.Setenv("SORACOM_COVERAGE_TYPE", tt.env)
+			if tt.env != "" {
+				t.Setenv("SORACOM_AUTH_KEY_ID", "keyId-xxx")
+				t.Setenv("SORACOM_AUTH_KEY", "secret-xxx")
+			}
+			writeProfile(t, "nssh", `{"authKeyId": "keyId-xxx", "authKey": "secret-xxx", "coverageType": "`+tt.profile+`"}`)
+
+			auth := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				return mockJSON(req, http.StatusOK, map[string]string{"apiKey": "api-key", "token": "token"})
+			})
+			c, err := NewSoracomClient(tt.coverageType, "nssh", WithTransport(auth), WithoutTokenCache())
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "invalid coverage type") {
+					t.Errorf("NewSoracomClient() = %v, want invalid coverage type", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.APIEndpoint() != tt.want {
+				t.Errorf("endpoint = %s, want %s", c.APIEndpoint(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package nssh
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/charmbracelet/bubbles/spinner"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An Emitter reports progress of nssh, either as human readable messages
+// prefixed with "nssh: ", or as JSON lines for tooling
+type Emitter struct {
+	w       io.Writer
+	json    bool
+	lang    string
+	spinner bool
+
+	mu     sync.Mutex // guards w while a spinner is shown
+	active string     // message of the spinner being shown, if any
+}
+
+// NewTextEmitter returns new Emitter which writes human readable messages in
+// lang, "en" or "ja", to w
+func NewTextEmitter(w io.Writer, lang string) *Emitter {
+	return &Emitter{w: w, lang: lang}
+}
+
+// NewJSONEmitter returns new Emitter which writes an event per line to w as
+// JSON, e.g. {"event":"sim_found","simId":"...","time":"..."}
+func NewJSONEmitter(w io.Writer) *Emitter {
+	return &Emitter{w: w, json: true}
+}
+
+// Emit reports the event with fields. Text emitter writes the message
+// formatted with format and args, or nothing if format is empty, and JSON
+// emitter writes the event and fields.
+func (e *Emitter) Emit(event string, fields map[string]any, format string, args ...any) {
+	if !e.json {
+		if format != "" {
+			e.mu.Lock()
+			defer e.mu.Unlock()
+			if e.active != "" {
+				// the spinner is drawn again on the next frame
+				_, _ = fmt.Fprint(e.w, "\r\033[K")
+			}
+			_, _ = fmt.Fprintf(e.w, "nssh: "+translate(e.lang, format)+"\n", args...)
+		}
+		return
+	}
+
+	v := map[string]any{}
+	for k, f := range fields {
+		if err, ok := f.(error); ok {
+			f = err.Error()
+		}
+		v[k] = f
+	}
+	v["time"] = time.Now().Format(time.RFC3339)
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	// put the event first for readability, as json.Marshal sorts the keys
+	name, _ := json.Marshal(event)
+	_, _ = fmt.Fprintf(e.w, "{\"event\":%s,%s\n", name, b[1:])
+}
+
+// SetSpinner enables or disables the spinner shown by Progress. Enable it only
+// if the text emitter writes to a terminal.
+func (e *Emitter) SetSpinner(enabled bool) {
+	e.spinner = enabled
+}
+
+// Progress reports the event like Emit, for a step which may take a while.
+// With the spinner enabled, the message is shown with a spinner until the
+// returned function is called with the result of the step, then replaced by
+// a check mark or a cross. The returned function does nothing otherwise.
+func (e *Emitter) Progress(event string, fields map[string]any, format string, args ...any) func(error) {
+	e.mu.Lock()
+	if e.json || !e.spinner || format == "" || e.active != "" {
+		// only one spinner is shown at a time
+		e.mu.Unlock()
+		e.Emit(event, fields, format, args...)
+		return func(error) {}
+	}
+	msg := fmt.Sprintf(translate(e.lang, format), args...)
+	e.active = msg
+	e.mu.Unlock()
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(spinner.MiniDot.FPS)
+		defer ticker.Stop()
+		for i := 0; ; i++ {
+			e.mu.Lock()
+			frame := fmt.Sprintf(spinnerColor, spinner.MiniDot.Frames[i%len(spinner.MiniDot.Frames)])
+			_, _ = fmt.Fprintf(e.w, "\r\033[Knssh: %s %s", frame, firstLine(msg))
+			e.mu.Unlock()
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return func(err error) {
+		close(done)
+		<-stopped
+
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.active = ""
+		mark := successMark
+		if err != nil {
+			mark = failureMark
+		}
+		_, _ = fmt.Fprintf(e.w, "\r\033[Knssh: %s %s\n", mark, msg)
+	}
+}
+
+// the spinner and the marks shown by Progress, colored with ANSI escape
+// sequences not to query the terminal for its capabilities
+const (
+	spinnerColor = "\033[36m%s\033[0m"
+	successMark  = "\033[32m✓\033[0m"
+	failureMark  = "\033[31m✗\033[0m"
+)
+
+// firstLine returns the first line of s, not to break redrawing the spinner
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
@@ -0,0 +1,158 @@
+package nssh
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A LocalForward forwards connections to a local address to an address seen
+// from the device, like -L of OpenSSH
+type LocalForward struct {
+	Listen string // local address to listen on, e.g. "localhost:8080"
+	Remote string // address to connect to from the device, e.g. "localhost:80"
+}
+
+func (f LocalForward) String() string {
+	return fmt.Sprintf("%s -> %s", f.Listen, f.Remote)
+}
+
+// ParseLocalForward parses spec in the form of [bind_address:]port:host:hostport
+// as -L of OpenSSH. IPv6 addresses are enclosed in square brackets. The bind
+// address is localhost if omitted, and all interfaces if empty or "*".
+func ParseLocalForward(spec string) (LocalForward, error) {
+	fields := splitForwardSpec(spec)
+	bind := "localhost"
+	switch len(fields) {
+	case 3:
+	case 4:
+		bind, fields = fields[0], fields[1:]
+		if bind == "*" {
+			bind = ""
+		}
+	default:
+		return LocalForward{}, fmt.Errorf("invalid local forward %q, specify [bind_address:]port:host:hostport", spec)
+	}
+
+	for _, p := range []string{fields[0], fields[2]} {
+		if n, err := strconv.Atoi(p); err != nil || n < 1 || n > 65535 {
+			return LocalForward{}, fmt.Errorf("invalid port %q in local forward %q", p, spec)
+		}
+	}
+	host := strings.TrimSuffix(strings.TrimPrefix(fields[1], "["), "]")
+	if host == "" {
+		return LocalForward{}, fmt.Errorf("no host in local forward %q", spec)
+	}
+	bind = strings.TrimSuffix(strings.TrimPrefix(bind, "["), "]")
+	return LocalForward{
+		Listen: net.JoinHostPort(bind, fields[0]),
+		Remote: net.JoinHostPort(host, fields[2]),
+	}, nil
+}
+
+// splitForwardSpec splits spec at colons outside of square brackets
+func splitForwardSpec(spec string) []string {
+	var fields []string
+	start, bracket := 0, false
+	for i, r := range spec {
+		switch {
+		case r == '[':
+			bracket = true
+		case r == ']':
+			bracket = false
+		case r == ':' && !bracket:
+			fields = append(fields, spec[start:i])
+			start = i + 1
+		}
+	}
+	return append(fields, spec[start:])
+}
+
+// Forward listens on the local addresses of forwards, and relays each
+// accepted connection to the remote address through client established by
+// Dial, in background until the returned io.Closer is closed or client is
+// closed. Returns an error without forwarding anything if any of the addresses
+// cannot be listened on. Forwarding and Shell are independent, so that callers
+// can use either or both on the same client.
+func (c *SoracomClient) Forward(client *ssh.Client, forwards []LocalForward) (io.Closer, error) {
+	var listeners forwardListeners
+	for _, f := range forwards {
+		l, err := net.Listen("tcp", f.Listen)
+		if err != nil {
+			_ = listeners.Close()
+			return nil, fmt.Errorf("failed to listen on %s: %w", f.Listen, err)
+		}
+		listeners = append(listeners, l)
+	}
+
+	for i, l := range listeners {
+		remote := forwards[i].Remote
+		c.Emitter.Emit("forwarding", map[string]any{"listen": l.Addr().String(), "remote": remote}, "→ forward %s to %s from the device", l.Addr(), remote)
+		go c.serveForward(l, client, remote)
+	}
+	go func() {
+		// stop accepting once the connection is lost
+		_ = client.Wait()
+		_ = listeners.Close()
+	}()
+	return listeners, nil
+}
+
+// serveForward accepts connections on l, and relays each of them to remote
+// through client, until l is closed
+func (c *SoracomClient) serveForward(l net.Listener, client *ssh.Client, remote string) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			c.Logger.Debug("forward", "from", conn.RemoteAddr().String(), "to", remote)
+			remoteConn, err := client.Dial("tcp", remote)
+			if err != nil {
+				c.Emitter.Emit("forward_failed", map[string]any{"remote": remote, "error": err.Error()}, "→ failed to connect to %s from the device: %v", remote, err)
+				return
+			}
+			defer remoteConn.Close()
+			relay(conn, remoteConn)
+		}()
+	}
+}
+
+// relay copies data between a and b in both directions until both of them
+// reach EOF, closing the writing side of each when the other side ends
+func relay(a, b net.Conn) {
+	var wg sync.WaitGroup
+	copyAndClose := func(dst, src net.Conn) {
+		defer wg.Done()
+		_, _ = io.Copy(dst, src)
+		if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+			_ = cw.CloseWrite()
+		} else {
+			_ = dst.Close()
+		}
+	}
+	wg.Add(2)
+	go copyAndClose(a, b)
+	go copyAndClose(b, a)
+	wg.Wait()
+}
+
+// forwardListeners are the listeners of Forward, which are closed together
+type forwardListeners []net.Listener
+
+func (ls forwardListeners) Close() error {
+	var errs []error
+	for _, l := range ls {
+		if err := l.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,70 @@
+package nssh
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// A LastConnection represents the subscriber which nssh connected to most
+// recently with a profile, to reconnect quickly
+type LastConnection struct {
+	SIMID string `json:"simId"`
+	Login string `json:"login"`
+	Port  int    `json:"port"`
+}
+
+// lastConnectionPath returns path to the file of the last connection for the
+// profile. The file name should not end with .json, not to be listed as a
+// profile.
+func lastConnectionPath(profileName string) (string, error) {
+	dir, err := getProfileDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, ".nssh-"+profileName+".last"), nil
+}
+
+// LoadLastConnection returns the last connection saved for the profile, or nil
+// without an error if nothing is saved
+func LoadLastConnection(profileName string) (*LastConnection, error) {
+	path, err := lastConnectionPath(profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var lc LastConnection
+	if err := json.Unmarshal(b, &lc); err != nil {
+		return nil, err
+	}
+	if lc.SIMID == "" {
+		return nil, nil
+	}
+	return &lc, nil
+}
+
+// SaveLastConnection saves the last connection for the profile
+func SaveLastConnection(profileName string, lc *LastConnection) error {
+	path, err := lastConnectionPath(profileName)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(lc)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0600)
+}
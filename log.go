@@ -0,0 +1,86 @@
+package nssh
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// LevelTrace is the log level to dump request and response bodies, which is
+// more verbose than slog.LevelDebug
+const LevelTrace = slog.Level(-8)
+
+// keys of JSON fields whose values are never logged
+var sensitiveKeys = map[string]bool{
+	"authkey":   true,
+	"authkeyid": true,
+	"apikey":    true,
+	"token":     true,
+	"password":  true,
+}
+
+// NewLogger returns new logger which writes to w with the level for specified
+// verbosity: 1 for slog.LevelInfo, 2 for slog.LevelDebug, 3 or more for
+// LevelTrace. If verbosity is 0 or less, the logger discards everything.
+func NewLogger(w io.Writer, verbosity int) *slog.Logger {
+	if verbosity <= 0 {
+		return slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+
+	level := LevelTrace
+	switch verbosity {
+	case 1:
+		level = slog.LevelInfo
+	case 2:
+		level = slog.LevelDebug
+	}
+
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.LevelKey && a.Value.Any() == LevelTrace {
+				a.Value = slog.StringValue("TRACE")
+			}
+			return a
+		},
+	}))
+}
+
+// redact returns JSON body with values of sensitive fields, e.g. auth key and
+// token, replaced. If the body is not JSON, only its length is returned.
+func redact(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return fmt.Sprintf("(%d bytes of non-JSON body)", len(body))
+	}
+
+	b, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return fmt.Sprintf("(%d bytes of body)", len(body))
+	}
+	return string(b)
+}
+
+func redactValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			if sensitiveKeys[strings.ToLower(k)] {
+				v[k] = "REDACTED"
+			} else {
+				v[k] = redactValue(e)
+			}
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = redactValue(e)
+		}
+	}
+	return v
+}
@@ -0,0 +1,79 @@
+package nssh
+
+import (
+	"os"
+	"strings"
+)
+
+// translations of the progress messages, keyed by language and the format in
+// English. Messages without translation are shown in English.
+var messages = map[string]map[string]string{
+	"ja": {
+		"connect to %s@%s":                                               "%s@%s に接続します",
+		"connect to %s@%s:%d using the port mapping":                     "ポートマッピングを使用して %s@%s:%d に接続します",
+		"connect to %s@%s:%d using the port mapping\n%s":                 "ポートマッピングを使用して %s@%s:%d に接続します\n%s",
+		"connect to jump host %s@%s:%d using the port mapping":           "ポートマッピングを使用して踏み台 %s@%s:%d に接続します",
+		"dry run: would reuse the port mapping, then connect as %s:\n%s": "ドライラン: 次のポートマッピングを再利用して %s として接続します:\n%s",
+		"dry run: would create port mapping for %s:%d, then connect as %s:\n- Duration: %d minutes\n- Source: %s\n- TLS required: %v\n- Delete after the session: %v": "ドライラン: %s:%d へのポートマッピングを作成して %s として接続します:\n- 有効期間: %d 分\n- 接続元: %s\n- TLS 必須: %v\n- セッション終了後に削除: %v",
+		"get SIM %s":                              "SIM %s を取得します",
+		"search SIM with IMSI %s":                 "IMSI %s の SIM を検索します",
+		"search existing port mappings for %s:%d": "%s:%d の既存のポートマッピングを検索します",
+		"search subscribers named \"%s\"":         "名前が \"%s\" のサブスクライバーを検索します",
+		"→ %d of %d port mappings are in use, delete unused ones with `nssh delete <subscriber name>`": "→ ポートマッピングを %d / %d 件使用中です。不要なものを `nssh delete <subscriber name>` で削除してください",
+		"→ %v, reconnect in %s (%d/%d)": "→ %[1]v のため、%[2]s 後に再接続します (%[3]d/%[4]d)",
+		"→ connect as root. Devices on Napter may be exposed, so consider less privileged user. Specify --yes to suppress this warning": "→ root として接続します。Napter 経由のデバイスは露出している可能性があるため、権限の少ないユーザーを検討してください。--yes を指定するとこの警告を表示しません",
+		"→ banner from the server:\n%s":          "→ サーバーのバナー:\n%s",
+		"→ certificate %s expired at %s":         "→ 証明書 %s は %s に期限切れになっています",
+		"→ certificate %s is not valid until %s": "→ 証明書 %s は %s まで有効になりません",
+		"→ failed on %d of %d subscribers":       "→ %[2]d 件中 %[1]d 件のサブスクライバーで失敗しました",
+		"→ establish SSH connection to %s":       "→ %s に SSH 接続します",
+		"→ port mapping %s to the same port exists, but does not permit current IP address. Specify --reuse to replace it": "→ 同じポートへのポートマッピング %s がありますが、現在の IP アドレスを許可していません。--reuse を指定すると置き換えます",
+		"→ check allowed CIDR for current IP address is %s":                                                                "→ 現在の IP アドレス %s が許可されているか確認します",
+		"→ created port mapping:\n%s":                                               "→ ポートマッピングを作成しました:\n%s",
+		"→ deleted port mapping %s":                                                 "→ ポートマッピング %s を削除しました",
+		"→ failed to delete port mapping %s: %v":                                    "→ ポートマッピング %s を削除できませんでした: %v",
+		"→ failed to determine current IP address, no source CIDR is specified: %v": "→ 現在の IP アドレスを取得できなかったため、接続元 CIDR を指定しません: %v",
+		"→ failed to cache the token: %v":                                           "→ トークンをキャッシュできませんでした: %v",
+		"→ failed to determine current IP address: %v":                              "→ 現在の IP アドレスを取得できませんでした: %v",
+		"→ found %d port mapping(s) for %s:%d":                                      "→ %[2]s:%[3]d のポートマッピングが %[1]d 件見つかりました",
+		"→ forward %s to %s from the device":                                        "→ %s をデバイスから %s に転送します",
+		"→ failed to connect to %s from the device: %v":                             "→ デバイスから %s に接続できませんでした: %v",
+		"→ sent %s, received %s, duration %s":                                       "→ 送信 %s、受信 %s、接続時間 %s",
+		"→ use password in SORACOM_SSH_PASSWORD environment variable, which other processes of the user may read. Consider public key authentication": "→ SORACOM_SSH_PASSWORD 環境変数のパスワードを使用します。同じユーザーの他のプロセスから読み取られる可能性があるため、公開鍵認証を検討してください",
+		"→ press Ctrl+C to stop forwarding":              "→ Ctrl+C で転送を終了します",
+		"→ the connection is closed: %v":                 "→ 接続が閉じられました: %v",
+		"→ found SIM on %s coverage":                     "→ %s カバレッジで SIM が見つかりました",
+		"→ not found on %s coverage, search %s coverage": "→ %s カバレッジで見つからないため、%s カバレッジを検索します",
+		"→ found SIM %s":                                 "→ SIM %s が見つかりました",
+		"→ found available port mapping:\n%s":            "→ 利用可能なポートマッピングが見つかりました:\n%s",
+		"→ found more than %d SIMs, ignoring the rest":   "→ SIM が %d 件を超えたため、残りは無視します",
+		"→ found %d subscribers named \"%s\", selected %s with the smallest SIM ID as --select-first is specified": "→ 名前が \"%[2]s\" のサブスクライバーが %[1]d 件見つかったため、--select-first の指定により SIM ID が最小の %[3]s を選択しました",
+		"→ found multiple subscribers named \"%s\"":                                                                "→ 名前が \"%s\" のサブスクライバーが複数見つかりました",
+		"→ ignore %s: %v": "→ %s を無視します: %v",
+		"→ no existing port mapping for %s:%d, creating": "→ %s:%d の既存のポートマッピングがないため、作成します",
+		"→ the port mapping expires at %s, in %s":        "→ ポートマッピングは %s (%s 後) に期限切れになります",
+	},
+}
+
+// translate returns format translated into lang, or format as is if there is
+// no translation
+func translate(lang, format string) string {
+	if m, ok := messages[lang][format]; ok {
+		return m
+	}
+	return format
+}
+
+// SystemLang returns "ja" if the locale specified by LC_ALL, LC_MESSAGES or
+// LANG environment variable is Japanese, or "en" otherwise
+func SystemLang() string {
+	for _, key := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if v := os.Getenv(key); v != "" {
+			if strings.HasPrefix(v, "ja") {
+				return "ja"
+			}
+			return "en"
+		}
+	}
+	return "en"
+}
@@ -0,0 +1,287 @@
+package nssh
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/0x6b/nssh/models"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MockData is the fixture of SIMs and port mappings which the mock transport
+// serves instead of SORACOM API, e.g. for demos
+type MockData struct {
+	SIMs         []models.SIM         `json:"sims"`
+	PortMappings []models.PortMapping `json:"portMappings"`
+	Endpoint     string               `json:"endpoint"`  // host:port of port mappings created by the mock, e.g. local sshd. DefaultMockEndpoint if empty
+	IPAddress    string               `json:"ipAddress"` // current global IP address returned instead of the checkip service. DefaultMockIPAddress if empty
+}
+
+const (
+	// DefaultMockEndpoint is the endpoint of port mappings created by the mock
+	DefaultMockEndpoint = "127.0.0.1:22"
+	// DefaultMockIPAddress is current global IP address told by the mock
+	DefaultMockIPAddress = "192.0.2.1"
+)
+
+// LoadMockData reads MockData from JSON file at path
+func LoadMockData(path string) (*MockData, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var data MockData
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, fmt.Errorf("failed to parse mock data %s: %w", path, err)
+	}
+	return &data, nil
+}
+
+// A mockTransport serves SORACOM API and the checkip service from MockData.
+// Port mappings are created and deleted in memory.
+type mockTransport struct {
+	mu   sync.Mutex
+	data MockData
+}
+
+// NewMockTransport returns http.RoundTripper which serves the subset of
+// SORACOM API nssh uses from data, and current global IP address for any
+// other request, e.g. to the checkip service. data is copied, so that changes
+// of port mappings are not visible to the caller.
+func NewMockTransport(data *MockData) http.RoundTripper {
+	t := &mockTransport{data: *data}
+	t.data.SIMs = append([]models.SIM(nil), data.SIMs...)
+	t.data.PortMappings = append([]models.PortMapping(nil), data.PortMappings...)
+	if t.data.Endpoint == "" {
+		t.data.Endpoint = DefaultMockEndpoint
+	}
+	if t.data.IPAddress == "" {
+		t.data.IPAddress = DefaultMockIPAddress
+	}
+	return t
+}
+
+func (t *mockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		defer req.Body.Close()
+	}
+	path, ok := strings.CutPrefix(req.URL.Path, "/v1/")
+	if !ok {
+		return mockResponse(req, http.StatusOK, t.data.IPAddress+"\n"), nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch {
+	case req.Method == "POST" && path == "auth":
+		return mockJSON(req, http.StatusOK, map[string]string{"apiKey": "api-mock", "token": "mock"})
+	case req.Method == "GET" && path == "query/sims":
+		return mockJSON(req, http.StatusOK, t.querySIMs(req))
+	case req.Method == "GET" && path == "subscribers":
+		return mockJSON(req, http.StatusOK, t.listSubscribers(req))
+	case req.Method == "GET" && strings.HasPrefix(path, "subscribers/"):
+		imsi := strings.TrimPrefix(path, "subscribers/")
+		for _, sub := range t.subscribers() {
+			if sub.IMSI == imsi {
+				return mockJSON(req, http.StatusOK, sub)
+			}
+		}
+		return mockError(req, http.StatusNotFound, fmt.Sprintf("subscriber %s not found", imsi))
+	case req.Method == "GET" && path == "port_mappings":
+		return t.listPortMappings(req)
+	case req.Method == "GET" && strings.HasPrefix(path, "port_mappings/sims/"):
+		simID := strings.TrimPrefix(path, "port_mappings/sims/")
+		portMappings := []models.PortMapping{}
+		for _, pm := range t.data.PortMappings {
+			if pm.Destination.ID == simID {
+				portMappings = append(portMappings, pm)
+			}
+		}
+		return mockJSON(req, http.StatusOK, portMappings)
+	case req.Method == "GET" && strings.HasPrefix(path, "port_mappings/subscribers/"):
+		imsi := strings.TrimPrefix(path, "port_mappings/subscribers/")
+		portMappings := []models.PortMapping{}
+		for _, sub := range t.subscribers() {
+			if sub.IMSI != imsi {
+				continue
+			}
+			for _, pm := range t.data.PortMappings {
+				if pm.Destination.ID == sub.SIMID {
+					portMappings = append(portMappings, pm)
+				}
+			}
+		}
+		return mockJSON(req, http.StatusOK, portMappings)
+	case req.Method == "POST" && path == "port_mappings":
+		return t.createPortMapping(req)
+	case req.Method == "DELETE" && strings.HasPrefix(path, "port_mappings/"):
+		return t.deletePortMapping(req, strings.TrimPrefix(path, "port_mappings/"))
+	default:
+		return mockError(req, http.StatusNotFound, fmt.Sprintf("%s %s is not supported by the mock", req.Method, req.URL.Path))
+	}
+}
+
+// querySIMs returns SIMs matching name, imsi and sim_id partially, and
+// session_status of the query
+func (t *mockTransport) querySIMs(req *http.Request) []models.SIM {
+	q := req.URL.Query()
+	sims := []models.SIM{}
+	for _, s := range t.data.SIMs {
+		if name := q.Get("name"); name != "" && !strings.Contains(strings.ToLower(s.Tags.Name), strings.ToLower(name)) {
+			continue
+		}
+		if simID := q.Get("sim_id"); simID != "" && !strings.Contains(s.ID, simID) {
+			continue
+		}
+		if imsi := q.Get("imsi"); imsi != "" && !hasIMSI(s, imsi) {
+			continue
+		}
+		if q.Get("session_status") == "ONLINE" && !s.SessionStatus.Online {
+			continue
+		}
+		sims = append(sims, s)
+	}
+	return sims
+}
+
+// subscribers returns the subscribers of the SIMs. A SIM without subscribers
+// in its profiles, e.g. in the fixture for demos, is served as a subscriber
+// whose IMSI is the SIM ID.
+func (t *mockTransport) subscribers() []models.Subscriber {
+	var subscribers []models.Subscriber
+	for _, s := range t.data.SIMs {
+		sub := models.Subscriber{SIMID: s.ID, SpeedClass: s.SpeedClass, Tags: s.Tags}
+		sub.SessionStatus.Online = s.SessionStatus.Online
+		sub.SessionStatus.LastUpdatedAt = s.SessionStatus.LastUpdatedAt
+
+		found := false
+		for _, p := range s.Profiles {
+			for _, ps := range p.Subscribers {
+				sub.IMSI, sub.Subscription = ps.Imsi, ps.Subscription
+				subscribers = append(subscribers, sub)
+				found = true
+			}
+		}
+		if !found {
+			sub.IMSI = s.ID
+			subscribers = append(subscribers, sub)
+		}
+	}
+	return subscribers
+}
+
+// listSubscribers returns subscribers whose tag of tag_name is tag_value of
+// the query, matching exactly or as prefix by tag_value_match_mode
+func (t *mockTransport) listSubscribers(req *http.Request) []models.Subscriber {
+	q := req.URL.Query()
+	subscribers := []models.Subscriber{}
+	for _, sub := range t.subscribers() {
+		if q.Get("tag_name") == "name" {
+			value := q.Get("tag_value")
+			if q.Get("tag_value_match_mode") == "prefix" && !strings.HasPrefix(sub.Tags.Name, value) ||
+				q.Get("tag_value_match_mode") != "prefix" && sub.Tags.Name != value {
+				continue
+			}
+		}
+		subscribers = append(subscribers, sub)
+	}
+	return subscribers
+}
+
+// hasIMSI returns true if any subscriber of the SIM has IMSI containing imsi
+func hasIMSI(sim models.SIM, imsi string) bool {
+	for _, p := range sim.Profiles {
+		for _, sub := range p.Subscribers {
+			if strings.Contains(sub.Imsi, imsi) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// listPortMappings returns a page of port mappings of the size of limit of the
+// query, with X-Soracom-Next-Key header telling the index of the next page
+func (t *mockTransport) listPortMappings(req *http.Request) (*http.Response, error) {
+	q := req.URL.Query()
+	start, _ := strconv.Atoi(q.Get("last_evaluated_key"))
+	start = min(max(start, 0), len(t.data.PortMappings))
+	end := len(t.data.PortMappings)
+	if limit, err := strconv.Atoi(q.Get("limit")); err == nil && limit > 0 && start+limit < end {
+		end = start + limit
+	}
+	res, err := mockJSON(req, http.StatusOK, append([]models.PortMapping{}, t.data.PortMappings[start:end]...))
+	if err == nil && end < len(t.data.PortMappings) {
+		res.Header.Set("X-Soracom-Next-Key", strconv.Itoa(end))
+	}
+	return res, err
+}
+
+func (t *mockTransport) createPortMapping(req *http.Request) (*http.Response, error) {
+	var pm models.PortMapping
+	if req.Body == nil || json.NewDecoder(req.Body).Decode(&pm) != nil {
+		return mockError(req, http.StatusBadRequest, "invalid request body")
+	}
+	host, port, err := net.SplitHostPort(t.data.Endpoint)
+	if err != nil {
+		return mockError(req, http.StatusInternalServerError, fmt.Sprintf("invalid endpoint of the mock %s", t.data.Endpoint))
+	}
+	pm.Endpoint = t.data.Endpoint
+	pm.Hostname = host
+	pm.IPAddress = host
+	pm.Port, _ = strconv.Atoi(port)
+	pm.CreatedTime = time.Now().UnixMilli()
+	if len(pm.Source.IPRanges) == 0 {
+		pm.Source.IPRanges = []string{t.data.IPAddress + "/32"}
+	}
+	t.data.PortMappings = append(t.data.PortMappings, pm)
+	return mockJSON(req, http.StatusCreated, pm)
+}
+
+func (t *mockTransport) deletePortMapping(req *http.Request, ipAndPort string) (*http.Response, error) {
+	for i, pm := range t.data.PortMappings {
+		if fmt.Sprintf("%s/%d", pm.IPAddress, pm.Port) == ipAndPort {
+			t.data.PortMappings = append(t.data.PortMappings[:i], t.data.PortMappings[i+1:]...)
+			return mockResponse(req, http.StatusNoContent, ""), nil
+		}
+	}
+	return mockError(req, http.StatusNotFound, fmt.Sprintf("port mapping %s not found", ipAndPort))
+}
+
+// mockJSON returns a response with v encoded as JSON
+func mockJSON(req *http.Request, status int, v any) (*http.Response, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	res := mockResponse(req, status, string(b))
+	res.Header.Set("Content-Type", "application/json")
+	return res, nil
+}
+
+// mockError returns an error response of SORACOM API with message
+func mockError(req *http.Request, status int, message string) (*http.Response, error) {
+	return mockJSON(req, status, map[string]string{"code": "MCK0001", "message": message})
+}
+
+// mockResponse returns a response with body
+func mockResponse(req *http.Request, status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Body:       io.NopCloser(bytes.NewReader([]byte(body))),
+		Request:    req,
+	}
+}
@@ -2,7 +2,10 @@ package models
 
 import (
 	"fmt"
+	"net"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // A PortMapping represents SORACOM Napter port mapping
@@ -13,6 +16,7 @@ type PortMapping struct {
 	IPAddress   string `json:"ipAddress"`   // SORACOM Napter IP address
 	Port        int    `json:"port"`        // SORACOM Napter port number
 	TLSRequired bool   `json:"tlsRequired"` // is TLS required
+	CreatedTime int64  `json:"createdTime"` // creation time in milliseconds since epoch
 	Destination struct {
 		ID   string `json:"simId"` // target SIM ID
 		Port int    `json:"port"`  // target port
@@ -30,3 +34,33 @@ func (pm PortMapping) String() string {
 		"- TLS required: %v",
 		pm.Hostname, pm.Port, pm.Destination.ID, pm.Destination.Port, float32(pm.Duration)/60/60, strings.Join(pm.Source.IPRanges, ","), pm.TLSRequired)
 }
+
+// SSHTarget returns hostname:port of the port mapping to connect to, or the
+// endpoint if the hostname is unknown
+func (pm PortMapping) SSHTarget() string {
+	if pm.Hostname == "" {
+		return pm.Endpoint
+	}
+	return net.JoinHostPort(pm.Hostname, strconv.Itoa(pm.Port))
+}
+
+// ExpiresAt returns the time when the port mapping expires, or false if the
+// creation time is unknown
+func (pm PortMapping) ExpiresAt() (time.Time, bool) {
+	if pm.CreatedTime == 0 {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(pm.CreatedTime).Add(time.Duration(pm.Duration) * time.Second), true
+}
+
+// AllowsIP returns true if any of the source CIDRs of the port mapping contains
+// ip. Malformed CIDRs are ignored.
+func (pm PortMapping) AllowsIP(ip net.IP) bool {
+	for _, r := range pm.Source.IPRanges {
+		_, ipNet, err := net.ParseCIDR(r)
+		if err == nil && ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"net"
+	"testing"
+)
+
+func TestPortMappingAllowsIP(t *testing.T) {
+	tests := []struct {
+		name     string
+		ipRanges []string
+		ip       string
+		want     bool
+	}{
+		{name: "IPv4 /32", ipRanges: []string{"192.0.2.1/32"}, ip: "192.0.2.1", want: true},
+		{name: "IPv4 /32 of another", ipRanges: []string{"192.0.2.1/32"}, ip: "192.0.2.2", want: false},
+		{name: "IPv4 range", ipRanges: []string{"198.51.100.0/24"}, ip: "198.51.100.200", want: true},
+		{name: "IPv4 out of range", ipRanges: []string{"198.51.100.0/24"}, ip: "198.51.101.1", want: false},
+		{name: "any of ranges", ipRanges: []string{"192.0.2.1/32", "203.0.113.0/24"}, ip: "203.0.113.5", want: true},
+		{name: "IPv6", ipRanges: []string{"2001:db8::/32"}, ip: "2001:db8::1", want: true},
+		{name: "IPv6 /128", ipRanges: []string{"2001:db8::1/128"}, ip: "2001:db8::2", want: false},
+		{name: "IPv4 in IPv6 range", ipRanges: []string{"2001:db8::/32"}, ip: "192.0.2.1", want: false},
+		{name: "all IPv4", ipRanges: []string{"0.0.0.0/0"}, ip: "192.0.2.1", want: true},
+		{name: "malformed skipped", ipRanges: []string{"192.0.2.1", "not a CIDR", "192.0.2.0/24"}, ip: "192.0.2.1", want: true},
+		{name: "only malformed", ipRanges: []string{"192.0.2.1", "192.0.2.0/33"}, ip: "192.0.2.1", want: false},
+		{name: "no ranges", ip: "192.0.2.1", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pm PortMapping
+			pm.Source.IPRanges = tt.ipRanges
+			if got := pm.AllowsIP(net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("AllowsIP(%s) with %v = %v, want %v", tt.ip, tt.ipRanges, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package models
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 // A SIM represents a SORACOM IoT SIM
 type SIM struct {
@@ -16,8 +19,12 @@ type SIM struct {
 		} `json:"subscribers"`
 	} `json:"profiles"`
 	SessionStatus struct {
-		Online bool   `json:"online"` // represents subscriber is online or not
-		Imsi   string `json:"imsi"`
+		Online        bool   `json:"online"` // represents subscriber is online or not
+		Imsi          string `json:"imsi"`
+		LastUpdatedAt int64  `json:"lastUpdatedAt"` // time of the last session event in milliseconds since epoch
+		Cell          struct {
+			RadioType string `json:"radioType"` // radio access technology e.g. lte, nb-iot
+		} `json:"cell"`
 	} `json:"sessionStatus"`
 	Tags struct {
 		Name string `json:"name,omitempty"` // name of the subscriber
@@ -42,9 +49,48 @@ func (s SIM) Title() string {
 	return fmt.Sprintf("%v %v", s.ID, name)
 }
 
-// Description returns subscription and type (speed class) as its description of the SIM, for interactive command
+// Description returns subscription, type (speed class) and session status as its description of the SIM, for interactive command
 func (s SIM) Description() string {
-	return fmt.Sprintf("%s (%s)", s.ActiveSubscription(), s.SpeedClass)
+	return fmt.Sprintf("%s (%s) - %s", s.ActiveSubscription(), s.SpeedClass, s.Status())
+}
+
+// Status returns online or offline, with the radio type and how long ago the
+// session status was updated if known, e.g. "online, lte, 5m ago"
+func (s SIM) Status() string {
+	status := "offline"
+	if s.SessionStatus.Online {
+		status = "online"
+	}
+	if s.SessionStatus.Cell.RadioType != "" {
+		status += ", " + s.SessionStatus.Cell.RadioType
+	}
+	if t, ok := s.LastSeen(); ok {
+		status += ", " + ago(time.Since(t))
+	}
+	return status
+}
+
+// LastSeen returns the time when the session status was updated, e.g. the
+// subscriber went online, or false if unknown
+func (s SIM) LastSeen() (time.Time, bool) {
+	if s.SessionStatus.LastUpdatedAt == 0 {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(s.SessionStatus.LastUpdatedAt), true
+}
+
+// ago returns d in the largest unit, e.g. "5m ago"
+func ago(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+	}
 }
 
 // FilterValue uses all fields as source of filter value of the SIM, for interactive command
@@ -52,8 +98,17 @@ func (s SIM) FilterValue() string {
 	return fmt.Sprintf("%s%s%s%s", s.ID, s.ActiveSubscription(), s.Tags.Name, s.SpeedClass)
 }
 
+// ActiveSubscription returns subscription of the primary subscriber of the
+// active profile, e.g. plan01s, or "" if the profile or the subscriber is
+// missing, e.g. in some provisioning states
 func (s SIM) ActiveSubscription() string {
-	activeProfile := s.Profiles[s.ActiveProfileID]
-	primaryImsi := activeProfile.PrimaryImsi
-	return activeProfile.Subscribers[primaryImsi].Subscription
+	activeProfile, ok := s.Profiles[s.ActiveProfileID]
+	if !ok {
+		return ""
+	}
+	subscriber, ok := activeProfile.Subscribers[activeProfile.PrimaryImsi]
+	if !ok {
+		return ""
+	}
+	return subscriber.Subscription
 }
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSIMActiveSubscription(t *testing.T) {
+	var sim SIM
+	if err := json.Unmarshal([]byte(`{
+		"simId": "8981100000000000001",
+		"activeProfileId": "8981100000000000001",
+		"speedClass": "s1.fast",
+		"profiles": {"8981100000000000001": {"primaryImsi": "440100000000001", "subscribers": {"440100000000001": {"imsi": "440100000000001", "subscription": "plan01s"}}}},
+		"tags": {"name": "gateway"}
+	}`), &sim); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := sim.ActiveSubscription(); got != "plan01s" {
+		t.Errorf("ActiveSubscription() = %q, want plan01s", got)
+	}
+	if got := sim.String(); got != "gateway (8981100000000000001 / plan01s / s1.fast)" {
+		t.Errorf("String() = %q", got)
+	}
+	if got := sim.Description(); got != "plan01s (s1.fast) - offline" {
+		t.Errorf("Description() = %q", got)
+	}
+}
+
+func TestSIMActiveSubscriptionMissing(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+	}{
+		{name: "no profiles", json: `{"simId": "1", "activeProfileId": "1"}`},
+		{name: "null profiles", json: `{"simId": "1", "activeProfileId": "1", "profiles": null}`},
+		{name: "no active profile ID", json: `{"simId": "1", "profiles": {"1": {"primaryImsi": "440100000000001"}}}`},
+		{name: "active profile missing", json: `{"simId": "1", "activeProfileId": "2", "profiles": {"1": {"primaryImsi": "440100000000001"}}}`},
+		{name: "no subscribers", json: `{"simId": "1", "activeProfileId": "1", "profiles": {"1": {"primaryImsi": "440100000000001"}}}`},
+		{name: "null subscribers", json: `{"simId": "1", "activeProfileId": "1", "profiles": {"1": {"primaryImsi": "440100000000001", "subscribers": null}}}`},
+		{name: "primary subscriber missing", json: `{"simId": "1", "activeProfileId": "1", "profiles": {"1": {"primaryImsi": "440100000000001", "subscribers": {"440100000000002": {"subscription": "plan01s"}}}}}`},
+		{name: "no primary IMSI", json: `{"simId": "1", "activeProfileId": "1", "profiles": {"1": {"subscribers": {"440100000000001": {"subscription": "plan01s"}}}}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sim SIM
+			if err := json.Unmarshal([]byte(tt.json), &sim); err != nil {
+				t.Fatal(err)
+			}
+			if got := sim.ActiveSubscription(); got != "" {
+				t.Errorf("ActiveSubscription() = %q, want empty", got)
+			}
+			if got := sim.String(); got != "Unknown (1 /  / )" {
+				t.Errorf("String() = %q", got)
+			}
+		})
+	}
+}
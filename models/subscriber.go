@@ -0,0 +1,27 @@
+package models
+
+import "fmt"
+
+// A Subscriber represents a subscriber of SORACOM Air, i.e. an IMSI of a SIM
+type Subscriber struct {
+	IMSI          string `json:"imsi"`
+	SIMID         string `json:"simId"`        // SIM ID of the SIM which has the subscriber
+	Subscription  string `json:"subscription"` // subscription e.g. plan01s, plan-D
+	SpeedClass    string `json:"type"`         // speed class e.g. s1.4xfast
+	SessionStatus struct {
+		Online        bool  `json:"online"`        // represents subscriber is online or not
+		LastUpdatedAt int64 `json:"lastUpdatedAt"` // time of the last session event in milliseconds since epoch
+	} `json:"sessionStatus"`
+	Tags struct {
+		Name string `json:"name,omitempty"` // name of the subscriber
+	} `json:"tags"`
+}
+
+func (s Subscriber) String() string {
+	name := s.Tags.Name
+	if s.Tags.Name == "" {
+		name = "Unknown"
+	}
+
+	return fmt.Sprintf("%v (%v / %v / %v)", name, s.IMSI, s.Subscription, s.SpeedClass)
+}
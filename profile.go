@@ -0,0 +1,156 @@
+package nssh
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mitchellh/go-homedir"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// A Profile represents a SORACOM CLI profile, which is stored as
+// <profile name>.json under the profile directory
+type Profile struct {
+	Name         string
+	AuthKeyID    string
+	AuthKey      string
+	CoverageType string
+}
+
+// ProfileDir returns the profile directory, which is SORACOM_PROFILE_DIR
+// environment variable if set, $XDG_CONFIG_HOME/soracom or
+// $HOME/.config/soracom if exists on Linux, or $HOME/.soracom
+func ProfileDir() (string, error) {
+	return getProfileDir()
+}
+
+// ListProfiles returns names of the profiles in the profile directory, sorted
+// alphabetically
+func ListProfiles() ([]string, error) {
+	dir, err := getProfileDir()
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, p := range paths {
+		names = append(names, strings.TrimSuffix(filepath.Base(p), ".json"))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// LoadProfile reads the profile, and returns an error if it cannot be parsed
+// or required fields are missing. Coverage type is optional, and
+// AutoCoverageType if missing.
+func LoadProfile(name string) (*Profile, error) {
+	dir, err := getProfileDir()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, name+".json")
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("profile \"%s\" not found at %s, create it with `soracom configure --profile %s` or by hand", name, path, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p := struct {
+		AuthKeyID    *string `json:"authKeyId"`
+		AuthKey      *string `json:"authKey"`
+		CoverageType *string `json:"coverageType"`
+	}{}
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse profile \"%s\" at %s: %w", name, path, err)
+	}
+
+	var missing []string
+	if p.AuthKeyID == nil {
+		missing = append(missing, `"authKeyId"`)
+	}
+	if p.AuthKey == nil {
+		missing = append(missing, `"authKey"`)
+	}
+	switch len(missing) {
+	case 0:
+	case 1:
+		return nil, fmt.Errorf("profile \"%s\" is missing required field %s (%s)", name, missing[0], path)
+	default:
+		return nil, fmt.Errorf("profile \"%s\" is missing required fields %s (%s)", name, strings.Join(missing, ", "), path)
+	}
+
+	coverageType := AutoCoverageType
+	if p.CoverageType != nil && *p.CoverageType != "" {
+		coverageType = *p.CoverageType
+	}
+	return &Profile{
+		Name:         name,
+		AuthKeyID:    *p.AuthKeyID,
+		AuthKey:      *p.AuthKey,
+		CoverageType: coverageType,
+	}, nil
+}
+
+// getAuthInfo returns auth key ID and auth key from SORACOM_AUTH_KEY_ID and
+// SORACOM_AUTH_KEY environment variables if both are set, without reading the
+// profile. Otherwise, returns them with coverage type from the profile. The
+// fourth return value reports whether the profile is read.
+func getAuthInfo(profileName string) (string, string, string, bool, error) {
+	akid, ak := os.Getenv("SORACOM_AUTH_KEY_ID"), os.Getenv("SORACOM_AUTH_KEY")
+	if akid != "" && ak != "" {
+		return akid, ak, "", false, nil
+	}
+	akid, ak, ct, err := getAuthInfoFromProfile(profileName)
+	return akid, ak, ct, true, err
+}
+
+func getAuthInfoFromProfile(profileName string) (string, string, string, error) {
+	p, err := LoadProfile(profileName)
+	if err != nil {
+		return "", "", "", err
+	}
+	return p.AuthKeyID, p.AuthKey, p.CoverageType, nil
+}
+
+// getProfileDir returns SORACOM_PROFILE_DIR environment variable if set. On
+// platforms other than macOS and Windows, $XDG_CONFIG_HOME/soracom, then
+// $HOME/.config/soracom is returned if exists. Otherwise $HOME/.soracom.
+func getProfileDir() (string, error) {
+	if profileDir := os.Getenv("SORACOM_PROFILE_DIR"); profileDir != "" {
+		return profileDir, nil
+	}
+
+	dir, err := homedir.Dir()
+	if err != nil {
+		return "", err
+	}
+
+	if runtime.GOOS != "darwin" && runtime.GOOS != "windows" {
+		var candidates []string
+		if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+			candidates = append(candidates, filepath.Join(xdg, "soracom"))
+		}
+		candidates = append(candidates, filepath.Join(dir, ".config", "soracom"))
+
+		for _, c := range candidates {
+			if fi, err := os.Stat(c); err == nil && fi.IsDir() {
+				return c, nil
+			}
+		}
+	}
+
+	return filepath.Join(dir, ".soracom"), nil
+}
@@ -0,0 +1,114 @@
+package nssh
+
+import (
+	"github.com/mitchellh/go-homedir"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// writeProfile writes the profile named name with content to a new profile
+// directory, which SORACOM_PROFILE_DIR points to
+func writeProfile(t *testing.T, name, content string) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("SORACOM_PROFILE_DIR", dir)
+	if err := os.WriteFile(filepath.Join(dir, name+".json"), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadProfileWithoutCoverageType(t *testing.T) {
+	writeProfile(t, "nssh", `{"authKeyId": "keyId-xxx", "authKey": "secret-xxx"}`)
+
+	p, err := LoadProfile("nssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.CoverageType != AutoCoverageType {
+		t.Errorf("CoverageType = %q, want %q", p.CoverageType, AutoCoverageType)
+	}
+}
+
+func TestProfileDir(t *testing.T) {
+	homedir.DisableCache = true
+	t.Cleanup(func() { homedir.DisableCache = false })
+
+	tests := []struct {
+		name    string
+		xdg     bool     // set XDG_CONFIG_HOME
+		mkdirs  []string // directories to create under the home directory
+		envDir  bool     // set SORACOM_PROFILE_DIR
+		want    string   // relative to the home directory
+		xdgOnly bool     // skipped on macOS and Windows, which do not look up XDG_CONFIG_HOME
+	}{
+		{name: "SORACOM_PROFILE_DIR", envDir: true, xdg: true, mkdirs: []string{"xdg/soracom"}, want: "env"},
+		{name: "XDG_CONFIG_HOME", xdg: true, mkdirs: []string{"xdg/soracom", ".config/soracom", ".soracom"}, want: "xdg/soracom", xdgOnly: true},
+		{name: "XDG_CONFIG_HOME without soracom", xdg: true, mkdirs: []string{".config/soracom"}, want: ".config/soracom", xdgOnly: true},
+		{name: ".config", mkdirs: []string{".config/soracom", ".soracom"}, want: ".config/soracom", xdgOnly: true},
+		{name: ".soracom", mkdirs: []string{".soracom"}, want: ".soracom"},
+		{name: "none", want: ".soracom"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.xdgOnly && (runtime.GOOS == "darwin" || runtime.GOOS == "windows") {
+				t.Skip("XDG_CONFIG_HOME is not looked up on", runtime.GOOS)
+			}
+			home := t.TempDir()
+			t.Setenv("HOME", home)
+			t.Setenv("USERPROFILE", home)
+			t.Setenv("SORACOM_PROFILE_DIR", "")
+			t.Setenv("XDG_CONFIG_HOME", "")
+			if tt.envDir {
+				t.Setenv("SORACOM_PROFILE_DIR", filepath.Join(home, "env"))
+			}
+			if tt.xdg {
+				t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "xdg"))
+			}
+			for _, d := range tt.mkdirs {
+				if err := os.MkdirAll(filepath.Join(home, d), 0700); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			dir, err := ProfileDir()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := filepath.Join(home, tt.want); dir != want {
+				t.Errorf("ProfileDir() = %s, want %s", dir, want)
+			}
+		})
+	}
+}
+
+func TestLoadProfileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string // written as the profile nssh unless empty
+		want    string
+	}{
+		{name: "not found", want: `profile "nssh" not found at`},
+		{name: "truncated", content: `{"authKeyId": "keyId-xxx", "authK`, want: `failed to parse profile "nssh"`},
+		{name: "not JSON", content: `authKeyId=keyId-xxx`, want: `failed to parse profile "nssh"`},
+		{name: "missing authKeyId", content: `{"authKey": "secret-xxx"}`, want: `profile "nssh" is missing required field "authKeyId"`},
+		{name: "missing authKey", content: `{"authKeyId": "keyId-xxx"}`, want: `profile "nssh" is missing required field "authKey"`},
+		{name: "missing both", content: `{"coverageType": "jp"}`, want: `profile "nssh" is missing required fields "authKeyId", "authKey"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.content == "" {
+				t.Setenv("SORACOM_PROFILE_DIR", t.TempDir())
+			} else {
+				writeProfile(t, "nssh", tt.content)
+			}
+
+			p, err := LoadProfile("nssh")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadProfile() = %v, %v, want error %q", p, err, tt.want)
+			}
+		})
+	}
+}
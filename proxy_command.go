@@ -0,0 +1,77 @@
+package nssh
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// ProxyCommandDialer returns a dialer for ConnectOptions.Dialer, which runs
+// command like ProxyCommand of OpenSSH and uses its stdin and stdout as the
+// connection, e.g. "ssh -W %h:%p bastion". %h and %p in command are replaced
+// with the host and the port of the port mapping, and %% with %. stderr of the
+// command is written to stderr.
+func ProxyCommandDialer(command string, stderr io.Writer) func(network, addr string) (net.Conn, error) {
+	return func(network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		cmd := shellCommand(expandProxyCommand(command, host, port))
+		cmd.Stderr = stderr
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, fmt.Errorf("failed to run proxy command: %w", err)
+		}
+
+		// net.Pipe supports deadlines, e.g. for ConnectOptions.Timeout
+		local, remote := net.Pipe()
+		go func() {
+			_, _ = io.Copy(stdin, remote)
+			_ = stdin.Close()
+		}()
+		go func() {
+			_, _ = io.Copy(remote, stdout)
+			_ = remote.Close()
+		}()
+		return &proxyCommandConn{Conn: local, cmd: cmd}, nil
+	}
+}
+
+// proxyCommandConn is a connection over stdin and stdout of the proxy command,
+// which is killed when the connection is closed
+type proxyCommandConn struct {
+	net.Conn
+	cmd *exec.Cmd
+}
+
+func (c *proxyCommandConn) Close() error {
+	err := c.Conn.Close()
+	_ = c.cmd.Process.Kill()
+	_ = c.cmd.Wait()
+	return err
+}
+
+// expandProxyCommand replaces %h, %p and %% in command. Other tokens are left
+// as is.
+func expandProxyCommand(command, host, port string) string {
+	return strings.NewReplacer("%%", "%", "%h", host, "%p", port).Replace(command)
+}
+
+// shellCommand returns the command to run command with the shell of the OS
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("sh", "-c", command)
+}
@@ -0,0 +1,55 @@
+package nssh
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// A SessionLog writes a transcript of SSH session to the underlying writer,
+// prefixing each line with timestamp. It is safe for concurrent use, and never
+// returns an error not to interrupt the session; writes after the first error
+// are discarded.
+type SessionLog struct {
+	mu        sync.Mutex
+	w         io.Writer
+	lineStart bool
+	err       error
+}
+
+// NewSessionLog returns a SessionLog which writes to w
+func NewSessionLog(w io.Writer) *SessionLog {
+	return &SessionLog{w: w, lineStart: true}
+}
+
+func (l *SessionLog) Write(b []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for rest := b; len(rest) > 0 && l.err == nil; {
+		if l.lineStart {
+			_, l.err = io.WriteString(l.w, time.Now().Format(time.RFC3339Nano)+" ")
+			l.lineStart = false
+		}
+		line := rest
+		for i, c := range rest {
+			if c == '\n' {
+				line = rest[:i+1]
+				l.lineStart = true
+				break
+			}
+		}
+		if l.err == nil {
+			_, l.err = l.w.Write(line)
+		}
+		rest = rest[len(line):]
+	}
+	return len(b), nil
+}
+
+// Err returns the first error occurred while writing, if any
+func (l *SessionLog) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
@@ -0,0 +1,120 @@
+package nssh
+
+import (
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
+	"os"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// state of the terminal before Connect puts it into raw mode, to restore it
+// even on unexpected exits
+var rawTerminal struct {
+	sync.Mutex
+	fd             int
+	state          *terminal.State
+	restoreConsole func()
+	title          bool // the window title is pushed by setTitle
+}
+
+// defaultTerminalModes returns modes for the remote PTY, which are used if
+// the local terminal settings are not available
+func defaultTerminalModes() ssh.TerminalModes {
+	return ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+}
+
+// terminalType returns term if not empty, TERM environment variable if set,
+// or "xterm"
+func terminalType(term string) string {
+	if term != "" {
+		return term
+	}
+	if term := os.Getenv("TERM"); term != "" {
+		return term
+	}
+	return "xterm"
+}
+
+// makeRaw puts the terminal into raw mode, and saves the previous state for
+// RestoreTerminal
+func makeRaw(fd int) error {
+	rawTerminal.Lock()
+	defer rawTerminal.Unlock()
+
+	restoreConsole, err := enableVirtualTerminal()
+	if err != nil {
+		return err
+	}
+	state, err := terminal.MakeRaw(fd)
+	if err != nil {
+		restoreConsole()
+		return err
+	}
+	rawTerminal.fd = fd
+	rawTerminal.state = state
+	rawTerminal.restoreConsole = restoreConsole
+	return nil
+}
+
+// setTitle saves the window title of the terminal in raw mode, and sets it to
+// title until RestoreTerminal. Control characters are removed from title, not
+// to let e.g. the name of the SIM inject escape sequences.
+func setTitle(title string) {
+	rawTerminal.Lock()
+	defer rawTerminal.Unlock()
+
+	if rawTerminal.state == nil {
+		return
+	}
+	title = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, title)
+	fmt.Printf("\033[22;0t\033]0;%s\007", title)
+	rawTerminal.title = true
+}
+
+// RestoreTerminal restores the terminal which Connect put into raw mode, if
+// any. It is safe to call multiple times, e.g. from signal handlers before
+// exiting.
+func RestoreTerminal() error {
+	rawTerminal.Lock()
+	defer rawTerminal.Unlock()
+
+	if rawTerminal.state == nil {
+		return nil
+	}
+	state := rawTerminal.state
+	rawTerminal.state = nil
+	if rawTerminal.title {
+		// pop the window title saved by setTitle
+		fmt.Print("\033[23;0t")
+		rawTerminal.title = false
+	}
+	err := terminal.Restore(rawTerminal.fd, state)
+	rawTerminal.restoreConsole()
+	return err
+}
+
+// recoverSession recovers a panic in a goroutine of the session, and closes
+// the session so that Connect returns and restores the terminal, instead of
+// crashing with the terminal left in raw mode
+func recoverSession(session interface{ Close() error }) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	_ = RestoreTerminal()
+	fmt.Fprintf(os.Stderr, "nssh: unexpected error: %v\n%s", r, debug.Stack())
+	_ = session.Close()
+}
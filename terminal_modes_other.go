@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package nssh
+
+import "golang.org/x/crypto/ssh"
+
+// terminalModes returns modes for the remote PTY. Local terminal settings are
+// not available on this platform.
+func terminalModes(fd int) ssh.TerminalModes {
+	return defaultTerminalModes()
+}
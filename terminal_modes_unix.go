@@ -0,0 +1,38 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package nssh
+
+import (
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/sys/unix"
+)
+
+// control characters passed to the remote PTY from the local terminal
+var controlChars = map[uint8]int{
+	ssh.VINTR:    unix.VINTR,
+	ssh.VQUIT:    unix.VQUIT,
+	ssh.VERASE:   unix.VERASE,
+	ssh.VKILL:    unix.VKILL,
+	ssh.VEOF:     unix.VEOF,
+	ssh.VSUSP:    unix.VSUSP,
+	ssh.VWERASE:  unix.VWERASE,
+	ssh.VLNEXT:   unix.VLNEXT,
+	ssh.VREPRINT: unix.VREPRINT,
+}
+
+// terminalModes returns modes for the remote PTY, with control characters of
+// the local terminal, e.g. erase with backspace or delete. It should be
+// called before the terminal is put into raw mode.
+func terminalModes(fd int) ssh.TerminalModes {
+	modes := defaultTerminalModes()
+
+	t, err := unix.IoctlGetTermios(fd, ioctlReadTermios)
+	if err != nil {
+		return modes
+	}
+	for op, i := range controlChars {
+		modes[op] = uint32(t.Cc[i])
+	}
+	return modes
+}
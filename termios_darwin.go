@@ -0,0 +1,5 @@
+package nssh
+
+import "golang.org/x/sys/unix"
+
+const ioctlReadTermios = unix.TIOCGETA
@@ -0,0 +1,51 @@
+package nssh
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Timings records how long each phase of connecting took, e.g. for
+// diagnosing whether slowness is SORACOM side or network side. Methods of nil
+// Timings do nothing.
+type Timings struct {
+	mu     sync.Mutex
+	phases []Timing
+}
+
+// A Timing represents duration of a phase
+type Timing struct {
+	Phase    string
+	Duration time.Duration
+}
+
+// Record records duration of phase which started at start
+func (t *Timings) Record(phase string, start time.Time) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.phases = append(t.phases, Timing{Phase: phase, Duration: time.Since(start)})
+}
+
+// Phases returns the recorded phases in order
+func (t *Timings) Phases() []Timing {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Timing(nil), t.phases...)
+}
+
+// String returns the recorded phases, one per line
+func (t *Timings) String() string {
+	var b strings.Builder
+	for _, p := range t.Phases() {
+		_, _ = fmt.Fprintf(&b, "- %s: %s\n", p.Phase, p.Duration.Round(time.Millisecond))
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
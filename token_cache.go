@@ -0,0 +1,91 @@
+package nssh
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// tokens which expire within this margin are not reused
+const tokenExpiryMargin = 5 * time.Minute
+
+// A tokenCache represents API key and token cached under the profile directory,
+// to reuse them across invocations
+type tokenCache struct {
+	Endpoint  string    `json:"endpoint"`
+	AuthKeyID string    `json:"authKeyId"`
+	APIKey    string    `json:"apiKey"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// tokenCachePath returns path to the token cache file for the profile and the
+// endpoint, so clients for each coverage type of AutoCoverageType do not
+// overwrite the token of the others. The file name should not end with .json,
+// not to be listed as a profile.
+func tokenCachePath(profileName, endpoint string) (string, error) {
+	dir, err := getProfileDir()
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid endpoint: %s", endpoint)
+	}
+	// the port, if any, is separated with _ as : is not allowed on Windows
+	host := strings.ReplaceAll(u.Host, ":", "_")
+	return filepath.Join(dir, ".nssh-"+profileName+"-"+host+".token"), nil
+}
+
+// loadTokenCache returns cached API key and token for the profile, if they are
+// issued for the same endpoint and auth key ID, still valid, and do not outlive
+// tokenTimeout seconds from now
+func loadTokenCache(profileName, endpoint, authKeyID string, tokenTimeout int) (*tokenCache, bool) {
+	path, err := tokenCachePath(profileName, endpoint)
+	if err != nil {
+		return nil, false
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+
+	var tc tokenCache
+	if err := json.Unmarshal(b, &tc); err != nil {
+		return nil, false
+	}
+
+	if tc.Endpoint != endpoint || tc.AuthKeyID != authKeyID || tc.APIKey == "" || tc.Token == "" {
+		return nil, false
+	}
+	now := time.Now()
+	if now.Add(tokenExpiryMargin).After(tc.ExpiresAt) || tc.ExpiresAt.After(now.Add(time.Duration(tokenTimeout)*time.Second)) {
+		return nil, false
+	}
+	return &tc, true
+}
+
+// saveTokenCache writes API key and token for the profile, readable only by
+// the user as it contains credentials
+func saveTokenCache(profileName string, tc *tokenCache) error {
+	path, err := tokenCachePath(profileName, tc.Endpoint)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(tc)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path, b, 0600); err != nil {
+		return err
+	}
+	// os.WriteFile does not change permission of existing file
+	return os.Chmod(path, 0600)
+}
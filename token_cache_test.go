@@ -0,0 +1,38 @@
+package nssh
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestTokenCachePerCoverageType(t *testing.T) {
+	for _, env := range []string{"SORACOM_API_KEY", "SORACOM_TOKEN", "SORACOM_AUTH_KEY_ID", "SORACOM_AUTH_KEY"} {
+		t.Setenv(env, "")
+	}
+	writeProfile(t, "nssh", `{"authKeyId": "keyId-xxx", "authKey": "secret-xxx", "coverageType": "auto"}`)
+
+	// authenticate on each coverage type in turn, with the token for its host
+	auth := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return mockJSON(req, http.StatusOK, map[string]string{"apiKey": "api-key-" + req.URL.Host, "token": "token-" + req.URL.Host})
+	})
+	for _, ct := range []string{"jp", "g"} {
+		if _, err := NewSoracomClient(ct, "nssh", WithTransport(auth)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// both tokens are reused without authentication
+	noAuth := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, errors.New("authenticated again")
+	})
+	for ct, host := range map[string]string{"jp": "api.soracom.io", "g": "g.api.soracom.io"} {
+		c, err := NewSoracomClient(ct, "nssh", WithTransport(noAuth))
+		if err != nil {
+			t.Fatalf("NewSoracomClient(%s) = %v, want the cached token", ct, err)
+		}
+		if apiKey, token := c.Credentials(); apiKey != "api-key-"+host || token != "token-"+host {
+			t.Errorf("credentials of %s = %s, %s, want the ones for %s", ct, apiKey, token, host)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package nssh
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NewHTTPClient returns new http.Client which sends requests via specified
+// proxy, and trusts specified CA certificate in addition to the system ones.
+// If proxy is empty, HTTPS_PROXY, HTTP_PROXY, and NO_PROXY environment
+// variables are honored. If caCert is empty, only the system root CAs are
+// trusted.
+func NewHTTPClient(proxy, caCert string) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if proxy != "" {
+		u, err := url.Parse(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL %s: %w", proxy, err)
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %s: scheme and host are required", proxy)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+
+	if caCert != "" {
+		pem, err := os.ReadFile(caCert)
+		if err != nil {
+			return nil, err
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificate found in %s", caCert)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// headers whose values are never written by the trace transport
+var sensitiveHeaders = []string{"X-Soracom-Api-Key", "X-Soracom-Token", "Authorization", "Proxy-Authorization"}
+
+// A traceTransport writes each request and response to w, with credentials
+// redacted
+type traceTransport struct {
+	base http.RoundTripper
+	mu   sync.Mutex
+	w    io.Writer
+}
+
+// NewTraceTransport returns http.RoundTripper which sends requests with base,
+// and writes each request and response to w, e.g. for support tickets. API key,
+// token, auth key and password are redacted from headers and JSON bodies.
+func NewTraceTransport(base http.RoundTripper, w io.Writer) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &traceTransport{base: base, w: w}
+}
+
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err == nil {
+			reqBody, _ = io.ReadAll(body)
+			_ = body.Close()
+		}
+	}
+
+	start := time.Now()
+	res, err := t.base.RoundTrip(req)
+
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "* %s\n> %s %s\n", start.Format(time.RFC3339Nano), req.Method, req.URL)
+	writeHeaders(&b, "> ", req.Header)
+	if len(reqBody) > 0 {
+		_, _ = fmt.Fprintf(&b, ">\n> %s\n", redact(reqBody))
+	}
+
+	if err != nil {
+		_, _ = fmt.Fprintf(&b, "< error: %v\n\n", err)
+	} else {
+		resBody, readErr := io.ReadAll(res.Body)
+		_ = res.Body.Close()
+		if readErr != nil {
+			return nil, readErr
+		}
+		res.Body = io.NopCloser(bytes.NewReader(resBody))
+
+		_, _ = fmt.Fprintf(&b, "< %s %s (%s)\n", res.Proto, res.Status, time.Since(start).Round(time.Millisecond))
+		writeHeaders(&b, "< ", res.Header)
+		if len(resBody) > 0 {
+			_, _ = fmt.Fprintf(&b, "<\n< %s\n", redact(resBody))
+		}
+		b.WriteString("\n")
+	}
+
+	t.mu.Lock()
+	_, _ = io.WriteString(t.w, b.String())
+	t.mu.Unlock()
+	return res, err
+}
+
+// writeHeaders writes headers sorted by name with prefix, with values of
+// sensitiveHeaders redacted
+func writeHeaders(b *strings.Builder, prefix string, header http.Header) {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, v := range header[name] {
+			for _, s := range sensitiveHeaders {
+				if strings.EqualFold(name, s) {
+					v = "REDACTED"
+				}
+			}
+			_, _ = fmt.Fprintf(b, "%s%s: %s\n", prefix, name, v)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package nssh
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Usage counts bytes sent to and received from the remote shell during the
+// session, e.g. to estimate data costs over cellular. SSH and TLS overhead is
+// not included. Methods of nil Usage do nothing.
+type Usage struct {
+	sent     atomic.Int64
+	received atomic.Int64
+
+	mu    sync.Mutex
+	start time.Time
+	end   time.Time
+}
+
+// Sent returns the number of bytes sent to the remote shell, i.e. stdin
+func (u *Usage) Sent() int64 {
+	if u == nil {
+		return 0
+	}
+	return u.sent.Load()
+}
+
+// Received returns the number of bytes received from the remote shell, i.e.
+// stdout and stderr
+func (u *Usage) Received() int64 {
+	if u == nil {
+		return 0
+	}
+	return u.received.Load()
+}
+
+// Duration returns how long the session lasted, or has lasted if it is not
+// ended yet. Zero if the session did not start.
+func (u *Usage) Duration() time.Duration {
+	if u == nil {
+		return 0
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	switch {
+	case u.start.IsZero():
+		return 0
+	case u.end.IsZero():
+		return time.Since(u.start)
+	default:
+		return u.end.Sub(u.start)
+	}
+}
+
+// String returns the summary, e.g. "sent 1.2 KB, received 34.5 KB, duration 5m3s"
+func (u *Usage) String() string {
+	return fmt.Sprintf("sent %s, received %s, duration %s", FormatBytes(u.Sent()), FormatBytes(u.Received()), u.Duration().Round(time.Second))
+}
+
+// begin records the start of the session
+func (u *Usage) begin() {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.start, u.end = time.Now(), time.Time{}
+}
+
+// finish records the end of the session
+func (u *Usage) finish() {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.end = time.Now()
+}
+
+// countReader returns r which counts bytes read from it as sent
+func (u *Usage) countReader(r io.Reader) io.Reader {
+	if u == nil {
+		return r
+	}
+	return &countingReader{r: r, n: &u.sent}
+}
+
+// countWriter returns w which counts bytes written to it as received
+func (u *Usage) countWriter(w io.Writer) io.Writer {
+	if u == nil {
+		return w
+	}
+	return &countingWriter{w: w, n: &u.received}
+}
+
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n *atomic.Int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// FormatBytes returns n in B, KB, MB or GB, in units of 1024, e.g. "1.2 KB"
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	f := float64(n) / unit
+	for _, suffix := range []string{"KB", "MB"} {
+		if f < unit {
+			return fmt.Sprintf("%.1f %s", f, suffix)
+		}
+		f /= unit
+	}
+	return fmt.Sprintf("%.1f GB", f)
+}